@@ -2,18 +2,19 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 
-	"github.com/BurntSushi/toml"
 	"github.com/Konatavi/go2HW2/internal/app/apiserver"
-	"github.com/joho/godotenv"
+	"github.com/Konatavi/go2HW2/internal/app/config"
 )
 
 var (
 	configPath        string
 	typeConfigFile    string
 	configPathDefault string = "configs/apiserver.toml"
+	envPrefix         string = "APISERVER_"
 )
 
 /*
@@ -28,60 +29,67 @@ api -format .toml -path configs/api.toml
 ```
 * Должна быть возможность запускать проект с дефолтными параметрами (дефолтным будем считать ```apiserver.toml```,
 если его нет, то запускаем с значениями из структуры ```Config```)
+
+Значения собираются слоями, каждый следующий перекрывает предыдущий:
+значения по умолчанию из apiserver.NewConfig < файл (-path) < переменные APISERVER_* < флаги (-log_level, -store.database_url ...)
 */
 
 func init() {
 	//Скажем, что наше приложение будет на этапе запуска получать путь до конфиг файла из внешнего мира
-	flag.StringVar(&typeConfigFile, "format", ".toml", "format config file in .toml format or .env")
-	flag.StringVar(&configPath, "path", "configs/apiserver.toml", "path to config file in .toml format")
-
+	flag.StringVar(&typeConfigFile, "format", "", "config file format: toml, yaml, json or env (guessed from the -path extension by default)")
+	flag.StringVar(&configPath, "path", configPathDefault, "path to config file")
+	//По флагу на каждый ключ конфига
+	config.RegisterFlags(flag.CommandLine, apiserver.NewConfig())
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [migrate up|down [N]|status|force VERSION | config print]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 }
 
 func main() {
 	//В этот момент происходит инициализация переменной configPath значением
 	flag.Parse()
-	log.Println("typeConfigFile (after Parse2): ", typeConfigFile, "configPath (after Parse2): ", configPath)
-	//server instance initialization
-	config := apiserver.NewConfig()
-	switch typeConfigFile {
-	case ".toml":
-		_, err := toml.DecodeFile(configPath, config) // Десериалзиуете содержимое .toml файла
-		if err != nil {
-			log.Printf("can not find configs file. using default file: %s Error: %s", configPathDefault, err)
-			_, err = toml.DecodeFile("configs/apiserver.toml", config)
-			if err != nil {
-				log.Fatal("can not find default configs file: ", err)
-			}
-		}
-	case ".env":
-		err := godotenv.Load(configPath)
-		if err != nil {
-			log.Printf("can not find configs file. using default file: %s Error: %s", configPathDefault, err)
-			_, err = toml.DecodeFile("configs/apiserver.toml", config)
-			if err != nil {
-				log.Fatal("can not find default configs file: ", err)
-			}
-		} else {
+	loader := newLoader()
+	cfg, sources, err := loadConfig(loader)
+	if err != nil {
+		log.Fatal("can not load config: ", err)
+	}
 
-			config.BindAddr = os.Getenv("bind_add")
-			config.LogLevel = os.Getenv("log_level")
-			config.Store.DatabaseURL = os.Getenv("database_url")
+	args := flag.Args()
+	switch {
+	case len(args) == 0:
+	//apiserver [flags] migrate up|down|status|force
+	case args[0] == "migrate":
+		if err := cfg.Store.Validate(); err != nil {
+			log.Fatal(err)
 		}
-
-	default:
-		{
-			log.Printf("can not find configs file. using default file: %s", configPathDefault)
-			_, err := toml.DecodeFile("configs/apiserver.toml", config)
-			if err != nil {
-				log.Fatal("can not find default configs file: ", err)
-			}
+		if err := runMigrate(cfg.Store, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	//apiserver [flags] config print
+	case args[0] == "config" && len(args) == 2 && args[1] == "print":
+		if err := config.Print(os.Stdout, cfg, sources); err != nil {
+			log.Fatal(err)
 		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 
+	//Не стартуем с некорректным конфигом, показываем сразу все проблемы
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
 	}
-	log.Println("config:", config)
 
 	//server instance
-	s := apiserver.New(config)
+	s := apiserver.New(cfg)
+	//Перечитываем конфиг по SIGHUP и при изменении файла
+	s.EnableReload(loader.Path, func() (*apiserver.Config, error) {
+		cfg, _, err := loadConfig(loader)
+		return cfg, err
+	})
 
 	//server start
 	if err := s.Start(); err != nil {
@@ -89,3 +97,43 @@ func main() {
 	}
 
 }
+
+// newLoader reads config from -path, APISERVER_* env vars and flags.
+// The default file is optional, a file given with -path must exist.
+func newLoader() *config.Loader {
+	loader := &config.Loader{
+		Path:      configPath,
+		Format:    typeConfigFile,
+		EnvPrefix: envPrefix,
+		Environ:   os.Environ(),
+		Flags:     flag.CommandLine,
+	}
+	if !flagIsSet("path") {
+		if _, err := os.Stat(configPath); os.IsNotExist(err) {
+			log.Printf("can not find default config file %s, using defaults", configPath)
+			loader.Path = ""
+		}
+	}
+	return loader
+}
+
+// loadConfig resolves the config from all layers
+func loadConfig(loader *config.Loader) (*apiserver.Config, config.Sources, error) {
+	loader.Environ = os.Environ()
+	cfg := apiserver.NewConfig()
+	sources, err := loader.Load(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, sources, nil
+}
+
+func flagIsSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -1,12 +1,24 @@
 package apiserver
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 
+	"github.com/Konatavi/go2HW2/internal/app/metrics"
 	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/internal/app/ratelimit"
+	"github.com/Konatavi/go2HW2/internal/app/tracing"
 	"github.com/Konatavi/go2HW2/store"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 var (
@@ -16,102 +28,358 @@ var (
 // type for APIServer object for instancing server
 type APIServer struct {
 	//Unexported field
-	config *Config
+	// cfg is replaced as a whole on reload, read it with config()
+	cfg    atomic.Pointer[Config]
 	logger *logrus.Logger
-	router *mux.Router
-	store  *store.Store
+	// accessLogger writes one JSON line per request
+	accessLogger *logrus.Logger
+	logFile      *os.File
+	router       *mux.Router
+	store        *store.Store
+	jwt          *middleware.JWTAuth
+	cors         *middleware.CORS
+	// metrics is nil unless metrics.enabled
+	metrics *metrics.Metrics
+	limiter *ratelimit.Limiter
+	// anonymousRoutes are served without a token and rate limited per client IP only
+	anonymousRoutes map[string]bool
+	// shutdownTracing flushes spans on exit
+	shutdownTracing func(context.Context) error
+	// hot reload, see EnableReload
+	configPath string
+	reloader   Reloader
+	// hup receives SIGHUP from the start on, so an early one is not fatal
+	hup chan os.Signal
 }
 
 //APIServer constructor
 func New(config *Config) *APIServer {
-	return &APIServer{
-		config: config,
-		logger: logrus.New(),
-		router: mux.NewRouter(),
+	s := &APIServer{
+		logger:          logrus.New(),
+		accessLogger:    newAccessLogger(),
+		router:          mux.NewRouter(),
+		anonymousRoutes: make(map[string]bool),
 	}
+	s.cfg.Store(config)
+	return s
 }
 
-// Start http server and connection to db and logger confs
+//config is the current config, never changed in place
+func (s *APIServer) config() *Config {
+	return s.cfg.Load()
+}
+
+// Start http server and connection to db and logger confs.
+// Blocks until SIGINT/SIGTERM, then drains in-flight requests and closes the store.
+// Every component started is shut down again, whichever step fails.
 func (s *APIServer) Start() error {
 	if err := s.configureLogger(); err != nil {
 		return err
 	}
-	s.logger.Info("starting api server at port :", s.config.BindAddr)
-	s.configureRouter()
+	defer s.closeLogFile()
+	s.notifyReload()
+	defer s.stopReload()
+	s.logger.Info("starting api server at port :", s.config().BindAddr)
+	if err := s.configureTracing(); err != nil {
+		return err
+	}
+	defer s.flushTracing()
 	if err := s.configureStore(); err != nil {
 		return err
 	}
-	return http.ListenAndServe(s.config.BindAddr, s.router)
+	defer s.store.Close()
+	//Migrations run once the store got through, so they wait for Postgres like the store does
+	if err := s.migrate(); err != nil {
+		return err
+	}
+	if err := s.bootstrapAdmin(context.Background()); err != nil {
+		return err
+	}
+	if err := s.configureJWT(); err != nil {
+		return err
+	}
+	s.configureMetrics()
+	s.configureRateLimit()
+	s.configureRouter()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return s.serve(ctx)
+}
+
+//serve runs http server until ctx is done or the server fails, then shuts it down gracefully
+func (s *APIServer) serve(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.config().BindAddr,
+		Handler:           s.router,
+		ReadTimeout:       s.config().ReadTimeout,
+		ReadHeaderTimeout: s.config().ReadHeaderTimeout,
+		WriteTimeout:      s.config().WriteTimeout,
+		IdleTimeout:       s.config().IdleTimeout,
+	}
+	servers := []*http.Server{server}
+	if adminServer := s.adminServer(); adminServer != nil {
+		s.logger.Info("serving metrics at ", s.config().Metrics.BindAddr, "/metrics")
+		servers = append(servers, adminServer)
+	}
+	serverErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv := srv
+		go func() {
+			serverErr <- srv.ListenAndServe()
+		}()
+	}
+	go s.watchReload(ctx)
+
+	var err error
+	select {
+	case err = <-serverErr:
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("shutting down api server, waiting up to ", s.config().ShutdownTimeout, " for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config().ShutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			s.logger.Error("server at ", srv.Addr, " did not shut down gracefully: ", shutdownErr)
+			if err == nil {
+				err = shutdownErr
+			}
+		}
+	}
+	if err == nil {
+		s.logger.Info("api server stopped")
+	}
+	return err
 }
 
 //func for configureate logger, should be unexported
 func (s *APIServer) configureLogger() error {
-	level, err := logrus.ParseLevel(s.config.LogLevel)
+	level, err := logrus.ParseLevel(s.config().LogLevel)
 	if err != nil {
-		return nil
+		return err
 	}
 	s.logger.SetLevel(level)
+	s.setLogFormat(s.config().LogFormat)
 
-	return nil
+	return s.setLogFile(s.config().LogFile)
+}
+
+//newAccessLogger logs every request regardless of log_level
+func newAccessLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetFormatter(&logrus.JSONFormatter{})
+	l.SetLevel(logrus.InfoLevel)
+	return l
 }
 
 //func for configure Router
 func (s *APIServer) configureRouter() {
+	//Span per route, continues the trace of an incoming traceparent header
+	if s.config().Tracing.Enabled() {
+		s.router.Use(otelmux.Middleware(s.config().Tracing.ServiceName))
+	}
+	//Request id, request-scoped logger and access line
+	s.router.Use(middleware.AccessLog(s.logger, s.accessLogger))
+	s.router.NotFoundHandler = s.unmatched(http.NotFoundHandler())
+	s.router.MethodNotAllowedHandler = s.unmatched(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	if s.metrics != nil {
+		s.router.Use(s.metrics.Middleware)
+	}
+	//CORS заголовки для браузеров с разрешенных cors_origins, preflight отвечается здесь же
+	s.cors = middleware.NewCORS(s.config().CORSOrigins)
+	s.router.Use(s.cors.Handler)
+	s.router.PathPrefix("/").Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	//Лимиты запросов по маршрутам из rate_limit.routes - 429 и Retry-After при превышении
+	s.router.Use(s.limiter.Middleware)
+
+	// Проверки для оркестратора, без аутентификации
+	s.router.HandleFunc("/healthz", s.GetHealthz).Methods("GET")
+	s.router.HandleFunc("/readyz", s.GetReadyz).Methods("GET")
 
 	/// Необходимые роутеры
 
 	// 1) POST /register - позволяет зарегестрировать нового пользователя для API. Завершается кодом
 	//201 и сообщением {"Message" : "User created. Try to auth"} в случае, если такого
 	//пользователя еще не было в БД. В противном случае завершаемся кодом 400 и сообщением
-	//{"Error" : "User already exists"}.
-	s.router.HandleFunc(prefix+"/register", s.PostUserRegister).Methods("POST")
+	//{"Error" : "User already exists"}. С заголовком Idempotency-Key повтор запроса получает тот же ответ.
+	//Ключи без токена действуют только для того же адреса клиента и того же тела.
+	s.anonymous(prefix+"/register", s.idempotent(s.PostUserRegister)).Methods("POST")
 
 	// 2) POST /auth - возвращает JWT метку для зарегестрированных пользователей.
-	s.router.HandleFunc(prefix+"/auth", s.PostToAuth).Methods("POST")
+	s.anonymous(prefix+"/auth", s.PostToAuth).Methods("POST")
+
+	// POST /auth/refresh - новая пара токенов в обмен на одноразовый refresh токен.
+	s.anonymous(prefix+"/auth/refresh", s.PostRefresh).Methods("POST")
+
+	// POST /auth/logout - отзыв access токена (через denylist) и refresh токенов.
+	s.router.Handle(prefix+"/auth/logout", s.jwt.Handler(
+		http.HandlerFunc(s.PostLogout),
+	)).Methods("POST")
+
+	// PUT /admin/users/<username>/role - выдать роль {"role": "editor"}, DELETE - вернуть роль viewer.
+	//Первого администратора задаем в admin_username/admin_password: при старте он создается или повышается,
+	//только если в базе еще нет ни одного администратора
+	s.router.Handle(prefix+"/admin/users/{username}/role", s.authorized(models.RoleAdmin, s.PutUserRole)).Methods("PUT")
+	s.router.Handle(prefix+"/admin/users/{username}/role", s.authorized(models.RoleAdmin, s.DeleteUserRole)).Methods("DELETE")
+
+	// GET /admin/pool - статистика пула соединений с БД. В /readyz ее нет: он публичный
+	s.router.Handle(prefix+"/admin/pool", s.authorized(models.RoleAdmin, s.GetPoolStats)).Methods("GET")
+
+	// GET /admin/login-attempts - журнал попыток входа с IP, User-Agent и исходом
+	s.router.Handle(prefix+"/admin/login-attempts", s.authorized(models.RoleAdmin, s.GetLoginAttempts)).Methods("GET")
+
+	// Публичные ключи для проверки JWT (RFC 7517)
+	s.router.HandleFunc("/.well-known/jwks.json", s.GetJWKS).Methods("GET")
 
 	// 3) GET /auto/<string:mark> - возвращает информацию про автомобиль с именем mark и код 200.
-	//В случае, если автомобиля нет в БД в текущий момент возвращаем {"Error" : "Auto with
-	//that mark not found"} и код 404.
-	s.router.Handle(prefix+"/auto"+"/{mark}", middleware.JwtMiddleware.Handler(
-		http.HandlerFunc(s.GetAutoByMark),
-	)).Methods("GET")
+	//В случае, если автомобиля нет в БД в текущий момент возвращаем 404 и code "not_found".
+	s.router.Handle(prefix+"/auto"+"/{mark}", s.authorized(models.RoleViewer, s.GetAutoByMark)).Methods("GET")
 
 	// 4) POST /auto/<string:mark> - добавляет автомобиль с именем mark в БД. В случае успеха - 201 и
-	//сообщение {"Message" : "Auto created"}. В случае, если автомобиль с таким именем уже
-	//существует - 400 и {"Error" : "Auto with that mark exists"}.
-	s.router.Handle(prefix+"/auto"+"/{mark}", middleware.JwtMiddleware.Handler(
-		http.HandlerFunc(s.PostAuto),
-	)).Methods("POST")
+	//созданный автомобиль. В случае, если автомобиль с таким именем уже
+	//существует - 409 и code "conflict". С заголовком Idempotency-Key повтор запроса получает тот же ответ,
+	//тот же ключ с другим телом - 422 и code "idempotency_key_reused".
+	s.router.Handle(prefix+"/auto"+"/{mark}", s.authorized(models.RoleEditor, s.idempotent(s.PostAuto))).Methods("POST")
 
 	// 5) PUT /auto/<string:mark> - обновляет информацию про автомобиль с именем mark в БД. В
 	//случае успеха - 202 и сообщение {"Message" : "Auto updated"}. В случае, если автомобиля нет
-	//в БД в текущий момент возвращаем {"Error" : "Auto with that mark not found"} и код 404.
-	s.router.Handle(prefix+"/auto"+"/{mark}", middleware.JwtMiddleware.Handler(
-		http.HandlerFunc(s.PutAuto),
-	)).Methods("PUT")
+	//в БД в текущий момент возвращаем 404 и code "not_found". Другой mark в теле переименовывает автомобиль.
+	s.router.Handle(prefix+"/auto"+"/{mark}", s.authorized(models.RoleEditor, s.PutAuto)).Methods("PUT")
+
+	// PATCH /auto/<string:mark> - частичное обновление: JSON Merge Patch или JSON Patch
+	s.router.Handle(prefix+"/auto"+"/{mark}", s.authorized(models.RoleEditor, s.PatchAuto)).Methods("PATCH")
 
 	// 6) DELETE /auto/<string:mark> - удаляет информацию про автомобиль с именем mark из БД. В
 	//случае успеха - 202 и сообщение {"Message" : "Auto deleted"}. В случае, если автомобиля нет
-	//в БД в текущий момент возвращаем {"Error" : "Auto with that mark not found"} и код 404.
-	s.router.Handle(prefix+"/auto"+"/{mark}", middleware.JwtMiddleware.Handler(
-		http.HandlerFunc(s.DeleteAuto),
-	)).Methods("DELETE")
+	//в БД в текущий момент возвращаем 404 и code "not_found".
+	s.router.Handle(prefix+"/auto"+"/{mark}", s.authorized(models.RoleAdmin, s.DeleteAuto)).Methods("DELETE")
+
+	// 7) GET /stock - возвращает информацию про имеющиеся на данный момент в БД автомобили
+	// и код 200. Если под фильтры ничего не попало - пустой массив.
+	s.router.Handle(prefix+"/stock", s.authorized(models.RoleViewer, s.GetAllAutos)).Methods("GET")
 
-	// 7) GET /stock - возвращает информацию про все имеющиеся на данный момент в БД автомобили
-	// и код 200 в случае, если имеется хотя бы один автомобиль в наличии. В противном случае - 400 и
-	// сообщение {"Error" : "No one autos found in DataBase"}.
-	s.router.Handle(prefix+"/stock", middleware.JwtMiddleware.Handler(
-		http.HandlerFunc(s.GetAllAutos),
-	)).Methods("GET")
+}
+
+//anonymous registers a route served without a token. A token sent there anyway is ignored
+//by the rate limiter, so valid tokens of throwaway accounts do not buy extra requests
+func (s *APIServer) anonymous(path string, h http.HandlerFunc) *mux.Route {
+	s.anonymousRoutes[path] = true
+	return s.router.HandleFunc(path, h)
+}
 
+//authorized lets through requests with a valid token of a user with at least the given role
+func (s *APIServer) authorized(role string, h http.HandlerFunc) http.Handler {
+	return s.jwt.Handler(middleware.RequireRole(s.userRole, role, h))
+}
+
+//userRole is the middleware.RoleLookup over the users of the store
+func (s *APIServer) userRole(ctx context.Context, username string) (string, bool, error) {
+	u, err := s.store.Usersauto().FindByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return u.Role, true, nil
+}
+
+//configureTracing installs the span exporter, spans are only recorded if tracing is enabled
+func (s *APIServer) configureTracing() error {
+	shutdown, err := tracing.Setup(context.Background(), s.config().Tracing)
+	if err != nil {
+		return err
+	}
+	s.shutdownTracing = shutdown
+	if s.config().Tracing.Enabled() {
+		s.logger.Info("exporting spans to ", s.config().Tracing.Exporter)
+	}
+	return nil
+}
+
+//flushTracing exports the spans still buffered, bounded by shutdown_timeout
+func (s *APIServer) flushTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config().ShutdownTimeout)
+	defer cancel()
+	if err := s.shutdownTracing(ctx); err != nil {
+		s.logger.Error("can not flush spans: ", err)
+	}
+}
+
+//configureMetrics collects metrics of requests, store and authentication if metrics are enabled
+func (s *APIServer) configureMetrics() {
+	if !s.config().Metrics.Enabled {
+		return
+	}
+	s.metrics = metrics.New()
+	s.store.AddQueryHook(s.metrics.QueryHook)
+	if s.config().Store.Driver != store.DriverMemory {
+		s.metrics.RegisterDBStats(s.store.Stats)
+	}
+	s.jwt.OnFailure(s.metrics.AuthOutcome)
+}
+
+//adminServer serves /metrics on its own address, nil if metrics are disabled
+func (s *APIServer) adminServer() *http.Server {
+	if s.metrics == nil {
+		return nil
+	}
+	router := mux.NewRouter()
+	router.Handle("/metrics", s.metrics.Handler()).Methods("GET")
+	return &http.Server{
+		Addr:              s.config().Metrics.BindAddr,
+		Handler:           router,
+		ReadHeaderTimeout: s.config().ReadHeaderTimeout,
+		IdleTimeout:       s.config().IdleTimeout,
+	}
+}
+
+//configureJWT loads signing and verification keys
+func (s *APIServer) configureJWT() error {
+	keys, err := middleware.NewKeySet(s.config().JWT)
+	if err != nil {
+		return err
+	}
+	s.jwt = middleware.NewJwtMiddleware(keys, s.store.RevokedTokens())
+	return nil
+}
+
+//migrate applies pending migrations if auto_migrate is on
+func (s *APIServer) migrate() error {
+	if !s.config().AutoMigrate || s.config().Store.Driver == store.DriverMemory {
+		return nil
+	}
+	m, err := store.NewMigrator(s.config().Store)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil {
+		return fmt.Errorf("auto migrate: %w", err)
+	}
+	version, _, err := m.Status()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("database schema is at version ", version)
+	return nil
 }
 
 //configureStore method
 func (s *APIServer) configureStore() error {
-	st := store.New(s.config.Store)
+	st := store.New(s.config().Store)
 	if err := st.Open(); err != nil {
 		return err
 	}
+	if s.config().Tracing.Enabled() {
+		st.AddQueryHook(tracing.QueryHook)
+	}
 	s.store = st
 	return nil
 }
@@ -0,0 +1,52 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/store"
+)
+
+// bootstrapAdmin gives a fresh install its first admin, so admin routes are reachable
+// with any store driver. Nothing happens once some admin exists: admin_username may stay
+// in the config without undoing a later demotion. Otherwise admin_username is promoted,
+// or created with admin_password if missing.
+func (s *APIServer) bootstrapAdmin(ctx context.Context) error {
+	cfg := s.config()
+	if cfg.AdminUsername == "" {
+		return nil
+	}
+	users := s.store.Usersauto()
+	all, err := users.SelectAll(ctx)
+	if err != nil {
+		return fmt.Errorf("bootstrap admin: %w", err)
+	}
+	for _, u := range all {
+		if u.Role == models.RoleAdmin {
+			return nil
+		}
+	}
+
+	_, err = users.FindByUsername(ctx, cfg.AdminUsername)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		if cfg.AdminPassword == "" {
+			return fmt.Errorf("bootstrap admin: user %q does not exist and admin_password is empty", cfg.AdminUsername)
+		}
+		admin := &models.Usersauto{Username: cfg.AdminUsername, Password: cfg.AdminPassword, Role: models.RoleAdmin}
+		if _, err := users.Create(ctx, admin); err != nil {
+			return fmt.Errorf("bootstrap admin: %w", err)
+		}
+		s.logger.Info("bootstrap admin ", cfg.AdminUsername, " created")
+	case err != nil:
+		return fmt.Errorf("bootstrap admin: %w", err)
+	default:
+		if err := users.UpdateRole(ctx, cfg.AdminUsername, models.RoleAdmin); err != nil {
+			return fmt.Errorf("bootstrap admin: %w", err)
+		}
+		s.logger.Info("user ", cfg.AdminUsername, " is now an admin")
+	}
+	return nil
+}
@@ -1,20 +1,221 @@
 package apiserver
 
-import "github.com/Konatavi/go2HW2/store"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/metrics"
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/internal/app/validation"
+	"github.com/Konatavi/go2HW2/internal/app/ratelimit"
+	"github.com/Konatavi/go2HW2/internal/app/tracing"
+	"github.com/Konatavi/go2HW2/store"
+	"github.com/sirupsen/logrus"
+)
 
 //General config for rest api
 type Config struct {
 	//Port for start api
 	BindAddr string `toml:"bind_addr"`
 	LogLevel string `toml:"log_level"`
-	Store    *store.Config
+	// LogFormat is text or json
+	LogFormat string `toml:"log_format"`
+	// LogFile receives the log and the access lines, stderr if empty
+	LogFile string `toml:"log_file"`
+	// HTTP server timeouts, e.g. "15s"
+	ReadTimeout       time.Duration `toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `toml:"write_timeout"`
+	IdleTimeout       time.Duration `toml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests may take to finish after SIGINT/SIGTERM
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+	// ReadinessTimeout bounds the dependency checks of /readyz
+	ReadinessTimeout time.Duration `toml:"readiness_timeout"`
+	// MaxBodyBytes is the longest request body handlers accept
+	MaxBodyBytes int64 `toml:"max_body_bytes"`
+	// ReloadInterval is how often the config file is checked for changes, 0 reloads on SIGHUP only
+	ReloadInterval time.Duration `toml:"reload_interval"`
+	// CORSOrigins may call the API from a browser, e.g. "https://app.example.com", "*" allows any
+	CORSOrigins []string `toml:"cors_origins"`
+	// IdempotencyTTL is how long responses to requests with an Idempotency-Key are replayed
+	IdempotencyTTL time.Duration `toml:"idempotency_ttl"`
+	// MaxFailedLogins in a row from a client IP lock the username for that IP
+	// for LockoutDuration, 0 never locks
+	MaxFailedLogins int           `toml:"max_failed_logins"`
+	LockoutDuration time.Duration `toml:"lockout_duration"`
+	// AdminUsername is made an admin on start if there is no admin yet,
+	// and created with AdminPassword if missing
+	AdminUsername string `toml:"admin_username"`
+	AdminPassword string `toml:"admin_password" secret:"true"`
+	// AutoMigrate applies embedded migrations before serving
+	AutoMigrate bool          `toml:"auto_migrate"`
+	Store       *store.Config `toml:"store"`
+	// JWT signing and verification keys
+	JWT *middleware.JWTConfig `toml:"jwt"`
+	// Metrics served on a separate admin address
+	Metrics *metrics.Config `toml:"metrics"`
+	// Tracing exports OpenTelemetry spans
+	Tracing *tracing.Config `toml:"tracing"`
+	// RateLimit of requests per route and client
+	RateLimit *ratelimit.Config `toml:"rate_limit"`
 }
 
 //Should return default config
 func NewConfig() *Config {
 	return &Config{
-		BindAddr: ":8080",
-		LogLevel: "debug",
-		Store:    store.NewConfig(),
+		BindAddr:          ":8080",
+		LogLevel:          "debug",
+		LogFormat:         logFormatText,
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   20 * time.Second,
+		ReadinessTimeout:  2 * time.Second,
+		MaxBodyBytes:      1 << 20,
+		IdempotencyTTL:    24 * time.Hour,
+		MaxFailedLogins:   5,
+		LockoutDuration:   15 * time.Minute,
+		Store:             store.NewConfig(),
+		JWT:               middleware.NewJWTConfig(),
+		Metrics:           metrics.NewConfig(),
+		Tracing:           tracing.NewConfig(),
+		RateLimit:         ratelimit.NewConfig(),
+	}
+}
+
+// ConfigError lists every problem Validate found
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// limits checked by Validate
+const (
+	maxServerTimeout    = time.Hour
+	maxReadinessTimeout = time.Minute
+	maxBodyBytes        = 64 << 20
+	maxIdempotencyTTL   = 7 * 24 * time.Hour
+	maxLockoutDuration  = 24 * time.Hour
+)
+
+// Validate reports all problems of the config at once, including the store config and JWT keys
+func (c *Config) Validate() error {
+	var problems []string
+	if problem := checkAddr("bind_addr", c.BindAddr); problem != "" {
+		problems = append(problems, problem)
+	}
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("log_level %q is unknown, use one of panic, fatal, error, warn, info, debug, trace", c.LogLevel))
+	}
+	if c.LogFormat != logFormatText && c.LogFormat != logFormatJSON {
+		problems = append(problems, fmt.Sprintf("log_format %q is unknown, use text or json", c.LogFormat))
+	}
+	for _, origin := range c.CORSOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "") {
+			problems = append(problems, fmt.Sprintf("cors_origins %q is not an origin like https://app.example.com or *", origin))
+		}
+	}
+
+	timeouts := []struct {
+		key   string
+		value time.Duration
+		max   time.Duration
+	}{
+		{"read_timeout", c.ReadTimeout, maxServerTimeout},
+		{"read_header_timeout", c.ReadHeaderTimeout, maxServerTimeout},
+		{"write_timeout", c.WriteTimeout, maxServerTimeout},
+		{"idle_timeout", c.IdleTimeout, maxServerTimeout},
+		{"shutdown_timeout", c.ShutdownTimeout, maxServerTimeout},
+		{"readiness_timeout", c.ReadinessTimeout, maxReadinessTimeout},
+		{"idempotency_ttl", c.IdempotencyTTL, maxIdempotencyTTL},
+		{"lockout_duration", c.LockoutDuration, maxLockoutDuration},
+	}
+	for _, t := range timeouts {
+		if t.value <= 0 || t.value > t.max {
+			problems = append(problems, fmt.Sprintf("%s %s is out of range (0, %s]", t.key, t.value, t.max))
+		}
+	}
+	if c.MaxBodyBytes <= 0 || c.MaxBodyBytes > maxBodyBytes {
+		problems = append(problems, fmt.Sprintf("max_body_bytes %d is out of range (0, %d]", c.MaxBodyBytes, maxBodyBytes))
+	}
+	if c.MaxFailedLogins < 0 {
+		problems = append(problems, fmt.Sprintf("max_failed_logins %d must not be negative", c.MaxFailedLogins))
+	}
+	if c.ReloadInterval < 0 {
+		problems = append(problems, fmt.Sprintf("reload_interval %s must not be negative", c.ReloadInterval))
+	}
+	if c.ReadHeaderTimeout > c.ReadTimeout {
+		problems = append(problems, fmt.Sprintf("read_header_timeout %s is longer than read_timeout %s", c.ReadHeaderTimeout, c.ReadTimeout))
+	}
+	if c.AdminPassword != "" {
+		//The bootstrap admin has to pass the same rules as a registered user
+		admin := &models.Usersauto{Username: c.AdminUsername, Password: c.AdminPassword, Role: models.RoleAdmin}
+		var errs validation.Errors
+		if errors.As(validation.Struct(admin), &errs) {
+			for _, fe := range errs {
+				problems = append(problems, fmt.Sprintf("admin_%s %s", fe.Field, fe.Message))
+			}
+		}
+	}
+
+	if c.Store == nil {
+		problems = append(problems, "store section is missing")
+	} else if err := c.Store.Validate(); err != nil {
+		var storeErr *store.ConfigError
+		if errors.As(err, &storeErr) {
+			problems = append(problems, storeErr.Problems...)
+		} else {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.JWT == nil || len(c.JWT.Keys) == 0 {
+		problems = append(problems, "jwt.keys is empty, at least one signing key (e.g. a HS256 secret) is required")
+	} else if _, err := middleware.NewKeySet(c.JWT); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if c.Metrics == nil {
+		problems = append(problems, "metrics section is missing")
+	} else if c.Metrics.Enabled {
+		if problem := checkAddr("metrics.bind_addr", c.Metrics.BindAddr); problem != "" {
+			problems = append(problems, problem)
+		} else if c.Metrics.BindAddr == c.BindAddr {
+			problems = append(problems, fmt.Sprintf("metrics.bind_addr %q must differ from bind_addr", c.Metrics.BindAddr))
+		}
+	}
+	if c.Tracing == nil {
+		problems = append(problems, "tracing section is missing")
+	} else {
+		problems = append(problems, c.Tracing.Validate()...)
+	}
+	if c.RateLimit == nil {
+		problems = append(problems, "rate_limit section is missing")
+	} else {
+		problems = append(problems, c.RateLimit.Validate()...)
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// checkAddr describes what is wrong with the host:port addr of key, "" if nothing
+func checkAddr(key string, addr string) string {
+	if _, port, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Sprintf("%s %q is not host:port: %s", key, addr, err)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Sprintf("%s %q has invalid port", key, addr)
 	}
+	return ""
 }
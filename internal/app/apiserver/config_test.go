@@ -0,0 +1,78 @@
+package apiserver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/store"
+)
+
+func validConfig() *Config {
+	c := NewConfig()
+	c.Store.Driver = store.DriverMemory
+	c.JWT.SigningKeyID = "test"
+	c.JWT.Keys = []*middleware.JWTKey{{ID: "test", Algorithm: "HS256", Secret: "secret"}}
+	return c
+}
+
+func TestValidateAcceptsValidConfig(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		// want are parts of the problems, one per problem
+		want []string
+	}{
+		{"bind_addr without port", func(c *Config) { c.BindAddr = "localhost" }, []string{"bind_addr"}},
+		{"bind_addr with bad port", func(c *Config) { c.BindAddr = ":99999" }, []string{"bind_addr"}},
+		{"unknown log level", func(c *Config) { c.LogLevel = "verbose" }, []string{"log_level"}},
+		{"zero and huge timeouts", func(c *Config) {
+			c.WriteTimeout = 0
+			c.ReadinessTimeout = 2 * time.Hour
+		}, []string{"write_timeout", "readiness_timeout"}},
+		{"header timeout over read timeout", func(c *Config) { c.ReadHeaderTimeout = c.ReadTimeout + time.Second }, []string{"read_header_timeout"}},
+		{"postgres without url", func(c *Config) {
+			c.Store.Driver = store.DriverPostgres
+			c.Store.DatabaseURL = ""
+		}, []string{"store.database_url"}},
+		{"unknown driver", func(c *Config) { c.Store.Driver = "sqlite" }, []string{"store.driver"}},
+		{"no jwt keys", func(c *Config) { c.JWT.Keys = nil }, []string{"jwt.keys"}},
+		{"missing signing key", func(c *Config) { c.JWT.SigningKeyID = "other" }, []string{"other"}},
+		{"short admin password", func(c *Config) {
+			c.AdminUsername = "root"
+			c.AdminPassword = "short"
+		}, []string{"admin_password"}},
+		{"admin password without username", func(c *Config) { c.AdminPassword = "password1" }, []string{"admin_username"}},
+		{"all at once", func(c *Config) {
+			c.LogLevel = "verbose"
+			c.Store.Driver = "sqlite"
+			c.JWT.Keys = nil
+		}, []string{"log_level", "store.driver", "jwt.keys"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.change(c)
+			var configErr *ConfigError
+			if err := c.Validate(); !errors.As(err, &configErr) {
+				t.Fatalf("got %v, want ConfigError", err)
+			}
+			if len(configErr.Problems) != len(tt.want) {
+				t.Fatalf("got problems %q, want %d", configErr.Problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(configErr.Problems[i], want) {
+					t.Errorf("problem %q does not mention %s", configErr.Problems[i], want)
+				}
+			}
+		})
+	}
+}
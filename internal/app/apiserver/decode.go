@@ -0,0 +1,61 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodeJSON strictly decodes the request body into v. Unknown fields, data after the value
+// and bodies longer than max_body_bytes are rejected. An empty body is errEmptyBody.
+func (api *APIServer) decodeJSON(writer http.ResponseWriter, req *http.Request, v interface{}) error {
+	limit := api.config().MaxBodyBytes
+	dec := json.NewDecoder(http.MaxBytesReader(writer, req.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err, limit)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err != nil {
+			return decodeError(err, limit)
+		}
+		return errInvalidJSON.WithDetail("body must hold a single JSON value")
+	}
+	return nil
+}
+
+// readBody reads the whole request body, up to max_body_bytes
+func (api *APIServer) readBody(writer http.ResponseWriter, req *http.Request) ([]byte, error) {
+	limit := api.config().MaxBodyBytes
+	body, err := io.ReadAll(http.MaxBytesReader(writer, req.Body, limit))
+	if err != nil {
+		return nil, decodeError(err, limit)
+	}
+	if len(body) == 0 {
+		return nil, errEmptyBody
+	}
+	return body, nil
+}
+
+func decodeError(err error, limit int64) error {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		return errEmptyBody
+	case errors.As(err, &tooLarge):
+		return errBodyTooLarge.WithDetail(fmt.Sprintf("body must not be longer than %d bytes", limit))
+	}
+	return errInvalidJSON.WithDetail(jsonErrorDetail(err))
+}
+
+// jsonErrorDetail explains a json decoding error without Go type names
+func jsonErrorDetail(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Sprintf("field %s must be %s", typeErr.Field, typeErr.Type)
+	}
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
@@ -0,0 +1,35 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRegisterBodies(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.MaxBodyBytes = 256 })
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"valid", `{"username": "alice", "password": "password1"}`, http.StatusCreated},
+		{"empty", ``, http.StatusBadRequest},
+		{"unknown field", `{"username": "bob", "password": "password1", "admin": true}`, http.StatusBadRequest},
+		{"two values", `{"username": "bob", "password": "password1"} {}`, http.StatusBadRequest},
+		{"wrong type", `{"username": 1, "password": "password1"}`, http.StatusBadRequest},
+		{"too large", `{"username": "bob", "password": "` + strings.Repeat("a", 300) + `"}`, http.StatusRequestEntityTooLarge},
+		{"short password", `{"username": "bob", "password": "short"}`, http.StatusUnprocessableEntity},
+		{"password over 72 bytes", `{"username": "bob", "password": "` + strings.Repeat("ж", 40) + `"}`, http.StatusUnprocessableEntity},
+	}
+	for i, tt := range tests {
+		//Every case from its own client, so /register is not rate limited
+		remoteAddr := fmt.Sprintf("192.0.2.%d:1234", i+1)
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := do(s, "POST", prefix+"/register", tt.body, nil, remoteAddr); rec.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Konatavi/go2HW2/internal/app/problem"
+	"github.com/Konatavi/go2HW2/internal/app/validation"
+	"github.com/Konatavi/go2HW2/store"
+)
+
+// Problems the handlers answer with. Store errors are mapped in problemFor
+var (
+	errInvalidJSON           = problem.New(http.StatusBadRequest, problem.CodeInvalidJSON, "Provided json is invalid")
+	errEmptyBody             = errInvalidJSON.WithDetail("body is empty")
+	errBodyTooLarge          = problem.New(http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, "Request body is too large")
+	errValidationFailed      = problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "Provided data is invalid")
+	errUnsupportedMediaType  = problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMedia, "Unsupported content type")
+	errInvalidPatch          = problem.New(http.StatusBadRequest, problem.CodeInvalidPatch, "Provided patch is invalid")
+	errPatchFailed           = problem.New(http.StatusUnprocessableEntity, problem.CodePatchFailed, "Patch can not be applied")
+	errInvalidQuery          = problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, "Invalid query parameters")
+	errInvalidRole           = problem.New(http.StatusBadRequest, problem.CodeInvalidRole, "Role must be one of viewer, editor, admin")
+	errInvalidCredentials    = problem.New(http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid username or password")
+	errInvalidRefreshToken   = problem.New(http.StatusUnauthorized, problem.CodeInvalidRefreshToken, "Refresh token is invalid or expired")
+	errNotFound              = problem.New(http.StatusNotFound, problem.CodeNotFound, "Not found")
+	errConflict              = problem.New(http.StatusConflict, problem.CodeConflict, "Already exists")
+	errPreconditionFailed    = problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed, "Auto was changed, fetch it again")
+	errUnavailable           = problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, "We have some troubles to accessing database. Try again")
+	errInternal              = problem.New(http.StatusInternalServerError, problem.CodeInternal, "We have some troubles. Try again")
+	errInvalidIdempotencyKey = problem.New(http.StatusBadRequest, problem.CodeInvalidIdempotency, "Idempotency-Key is invalid")
+	errIdempotencyKeyReused  = problem.New(http.StatusUnprocessableEntity, problem.CodeIdempotencyReused, "Idempotency-Key was used for another request")
+	errIdempotencyKeyInUse   = problem.New(http.StatusConflict, problem.CodeIdempotencyInUse, "Request with this Idempotency-Key is still in progress")
+	errLoginLocked           = problem.New(http.StatusTooManyRequests, problem.CodeLoginLocked, "Too many failed logins, try again later")
+)
+
+// problemFor maps err to the problem sent to the client. Problems are sent as they are,
+// store errors by their kind, everything else is an internal error without details.
+func problemFor(err error) *problem.Problem {
+	var p *problem.Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		p := errValidationFailed.WithDetail(fmt.Sprintf("%d field(s) are invalid", len(fieldErrs)))
+		for _, fe := range fieldErrs {
+			p.InvalidParams = append(p.InvalidParams, problem.InvalidParam{Name: fe.Field, Rule: fe.Rule, Reason: fe.Message})
+		}
+		return p
+	}
+	var storeErr *store.Error
+	switch {
+	case errors.Is(err, store.ErrInvalidQuery):
+		return errInvalidQuery.WithDetail(err.Error())
+	case errors.Is(err, store.ErrNotFound) && errors.As(err, &storeErr):
+		return errNotFound.WithDetail(storeErr.Message)
+	case errors.Is(err, store.ErrConflict) && errors.As(err, &storeErr):
+		return errConflict.WithDetail(storeErr.Message)
+	case errors.Is(err, store.ErrVersionMismatch) && errors.As(err, &storeErr):
+		return errPreconditionFailed.WithDetail(storeErr.Message)
+	case errors.Is(err, store.ErrUnavailable), errors.Is(err, context.DeadlineExceeded):
+		return errUnavailable
+	}
+	return errInternal
+}
+
+// writeError logs err and answers with its problem
+func (api *APIServer) writeError(writer http.ResponseWriter, req *http.Request, err error) {
+	p := problemFor(err)
+	entry := api.log(req).WithError(err).WithField("code", p.Code)
+	if p.Status >= http.StatusInternalServerError {
+		entry.Error("Request failed")
+	} else {
+		entry.Info("Request failed")
+	}
+	problem.Write(writer, req, p)
+}
+
+// writeJSON answers with v as JSON
+func writeJSON(writer http.ResponseWriter, status int, v interface{}) {
+	initHeaders(writer)
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(v)
+}
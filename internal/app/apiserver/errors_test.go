@@ -0,0 +1,77 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/internal/app/problem"
+	"github.com/Konatavi/go2HW2/store"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"problem", errInvalidJSON, http.StatusBadRequest, problem.CodeInvalidJSON, ""},
+		{"not found", &store.Error{Kind: store.ErrNotFound, Message: `auto "bmw" not found`}, http.StatusNotFound, problem.CodeNotFound, `auto "bmw" not found`},
+		{"conflict", &store.Error{Kind: store.ErrConflict, Message: `auto "bmw" already exists`}, http.StatusConflict, problem.CodeConflict, `auto "bmw" already exists`},
+		{"unavailable", &store.Error{Kind: store.ErrUnavailable, Message: "database is unavailable", Err: errors.New("dial tcp: connection refused")}, http.StatusServiceUnavailable, problem.CodeUnavailable, ""},
+		{"anything else", errors.New(`pq: relation "automobiles" does not exist`), http.StatusInternalServerError, problem.CodeInternal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := problemFor(tt.err)
+			if p.Status != tt.status || p.Code != tt.code || p.Detail != tt.detail {
+				t.Fatalf("got %d %s %q", p.Status, p.Code, p.Detail)
+			}
+		})
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := tokenFor(t, s, "admin", models.RoleAdmin)
+	viewer := tokenFor(t, s, "viewer", models.RoleViewer)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+		code   string
+	}{
+		{"missing automobile", "GET", prefix + "/auto/lada", viewer, http.StatusNotFound, problem.CodeNotFound},
+		{"role required", "DELETE", prefix + "/auto/lada", viewer, http.StatusForbidden, problem.CodeForbidden},
+		{"no token", "GET", prefix + "/auto/lada", "", http.StatusUnauthorized, problem.CodeUnauthorized},
+		{"delete missing automobile", "DELETE", prefix + "/auto/lada", admin, http.StatusNotFound, problem.CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header http.Header
+			if tt.token != "" {
+				header = bearer(tt.token)
+			}
+			rec := do(s, tt.method, tt.path, "", header, "192.0.2.1:1234")
+			if rec.Code != tt.status {
+				t.Fatalf("got %d: %s", rec.Code, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+				t.Fatalf("got content type %s", ct)
+			}
+			var p problem.Problem
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != tt.code || p.Instance != tt.path {
+				t.Fatalf("got %+v", p)
+			}
+		})
+	}
+}
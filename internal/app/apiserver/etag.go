@@ -0,0 +1,107 @@
+package apiserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// etag of an auto is its version as a strong entity tag
+func etag(a *models.Automobiles) string {
+	return `"` + strconv.Itoa(a.Version) + `"`
+}
+
+// parseETags splits an If-Match or If-None-Match header. any is true for "*"
+func parseETags(header string) (tags []string, any bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, false
+}
+
+// ifNoneMatch reports whether a GET with If-None-Match already has the current auto.
+// It uses the weak comparison of RFC 7232, so W/"3" matches version 3 too.
+func ifNoneMatch(req *http.Request, a *models.Automobiles) bool {
+	header := req.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	tags, any := parseETags(header)
+	if any {
+		return true
+	}
+	current := etag(a)
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch reports whether a write with If-Match may change the current auto.
+// It uses the strong comparison of RFC 7232, weak tags never match.
+func ifMatch(req *http.Request, a *models.Automobiles) bool {
+	header := req.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	tags, any := parseETags(header)
+	if any {
+		return true
+	}
+	current := etag(a)
+	for _, tag := range tags {
+		if tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion turns If-Match into the version a write must find, 0 if the header is absent or "*".
+// If-Match uses the strong comparison, weak tags never match.
+// With several tags the current version is looked up and used if it is one of them.
+func (api *APIServer) ifMatchVersion(req *http.Request, mark string) (int, error) {
+	header := req.Header.Get("If-Match")
+	if header == "" {
+		return 0, nil
+	}
+	tags, any := parseETags(header)
+	if any {
+		return 0, nil
+	}
+	var versions []int
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+		if v, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return 0, errPreconditionFailed.WithDetail("If-Match holds no current entity tag")
+	case 1:
+		return versions[0], nil
+	}
+	current, err := api.store.Automobiles().FindAutomobileByMark(req.Context(), mark)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range versions {
+		if v == current.Version {
+			return v, nil
+		}
+	}
+	return 0, errPreconditionFailed.WithDetail("auto has entity tag " + etag(current))
+}
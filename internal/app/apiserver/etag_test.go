@@ -0,0 +1,55 @@
+package apiserver
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := tokenFor(t, s, "admin", models.RoleAdmin)
+	withHeader := func(name, value string) http.Header {
+		header := bearer(admin)
+		header.Set(name, value)
+		return header
+	}
+	rec := do(s, "POST", prefix+"/auto/bmw", `{"max_speed": 250}`, bearer(admin), "192.0.2.1:1234")
+	if rec.Code != http.StatusCreated || rec.Header().Get("ETag") != `"1"` {
+		t.Fatalf("got %d, etag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		header http.Header
+		want   int
+		etag   string
+	}{
+		{"get", "GET", "", bearer(admin), http.StatusOK, `"1"`},
+		{"get not modified", "GET", "", withHeader("If-None-Match", `"1"`), http.StatusNotModified, `"1"`},
+		{"get weak tag not modified", "GET", "", withHeader("If-None-Match", `W/"1"`), http.StatusNotModified, `"1"`},
+		{"get changed", "GET", "", withHeader("If-None-Match", `"7"`), http.StatusOK, `"1"`},
+		{"put current version", "PUT", `{"max_speed": 260}`, withHeader("If-Match", `"1"`), http.StatusAccepted, `"2"`},
+		{"put stale version", "PUT", `{"max_speed": 270}`, withHeader("If-Match", `"1"`), http.StatusPreconditionFailed, ""},
+		{"put weak tag", "PUT", `{"max_speed": 270}`, withHeader("If-Match", `W/"2"`), http.StatusPreconditionFailed, ""},
+		{"put any version", "PUT", `{"max_speed": 270}`, withHeader("If-Match", `*`), http.StatusAccepted, `"3"`},
+		{"patch stale version", "PATCH", `{"max_speed": 280}`, withHeader("If-Match", `"2"`), http.StatusPreconditionFailed, ""},
+		{"patch one of versions", "PATCH", `{"max_speed": 280}`, withHeader("If-Match", `"2", "3"`), http.StatusOK, `"4"`},
+		{"delete stale version", "DELETE", "", withHeader("If-Match", `"3"`), http.StatusPreconditionFailed, ""},
+		{"delete current version", "DELETE", "", withHeader("If-Match", `"4"`), http.StatusAccepted, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(s, tt.method, prefix+"/auto/bmw", tt.body, tt.header, "192.0.2.1:1234")
+			if rec.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := rec.Header().Get("ETag"); tt.etag != "" && got != tt.etag {
+				t.Fatalf("got etag %q, want %q", got, tt.etag)
+			}
+		})
+	}
+}
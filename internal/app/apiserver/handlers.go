@@ -1,16 +1,19 @@
 package apiserver
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/Konatavi/go2HW2/internal/app/metrics"
 	"github.com/Konatavi/go2HW2/internal/app/middleware"
 	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/store"
 
-	"github.com/form3tech-oss/jwt-go"
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 )
 
 type Message struct {
@@ -25,428 +28,411 @@ func initHeaders(writer http.ResponseWriter) {
 }
 
 /// Необходимые роутеры
+//Ошибки отдаются как application/problem+json (RFC 7807) со стабильным полем code, см. errors.go
 // 1) POST /register - позволяет зарегестрировать нового пользователя для API. Завершается кодом
 //201 и сообщением {"Message" : "User created. Try to auth"} в случае, если такого
-//пользователя еще не было в БД. В противном случае завершаемся кодом 400 и сообщением
-//{"Error" : "User already exists"}.
+//пользователя еще не было в БД. В противном случае завершаемся кодом 409 и code "conflict".
 func (api *APIServer) PostUserRegister(writer http.ResponseWriter, req *http.Request) {
-	initHeaders(writer)
-	api.logger.Info("Post User Register POST /api/v1/register")
 	var usersauto models.Usersauto
-	err := json.NewDecoder(req.Body).Decode(&usersauto)
-	if err != nil {
-		api.logger.Info("Invalid json recieved from client")
-		msg := Message{
-			StatusCode: 400,
-			Message:    "Provided json is invalid",
-			IsError:    true,
-		}
-		writer.WriteHeader(400)
-		json.NewEncoder(writer).Encode(msg)
-		return
-	}
-
-	//Пытаемся найти пользователя с таким логином в бд
-	_, ok, err := api.store.Usersauto().FindByUsername(usersauto.Username)
-	if err != nil {
-		api.logger.Info("Troubles while accessing database table (users) with id. err:", err)
-		msg := Message{
-			StatusCode: 500,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(500)
-		json.NewEncoder(writer).Encode(msg)
+	if err := api.decodeJSON(writer, req, &usersauto); err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
 
-	//Смотрим, если такой пользователь уже есть - то никакой регистрации мы не делаем!
-	if ok {
-		api.logger.Info("User with that ID already exists")
-		msg := Message{
-			StatusCode: 400,
-			Message:    "User already exists",
-			IsError:    true,
-		}
-		writer.WriteHeader(400)
-		json.NewEncoder(writer).Encode(msg)
+	//Роль при регистрации всегда минимальная, повысить ее может только администратор
+	usersauto.Role = models.RoleViewer
+	if err := usersauto.Validate(); err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
-	//Теперь пытаемся добавить в бд
-	usersautoAdded, err := api.store.Usersauto().Create(&usersauto)
+	//Пользователь с таким логином уже есть - уникальный индекс вернет store.ErrConflict
+	usersautoAdded, err := api.store.Usersauto().Create(req.Context(), &usersauto)
 	if err != nil {
-		api.logger.Info("Troubles while accessing database table (usersauto) with id. err:", err)
-		msg := Message{
-			StatusCode: 500,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(500)
-		json.NewEncoder(writer).Encode(msg)
+		api.writeError(writer, req, err)
 		return
 	}
 
-	msg := Message{
+	writeJSON(writer, 201, Message{
 		StatusCode: 201,
 		Message:    "User created. Try to auth",
 		IsError:    false,
-	}
-	writer.WriteHeader(201)
-	json.NewEncoder(writer).Encode(msg)
-	api.logger.Info("User successfully registered! Username:", usersautoAdded.Username)
+	})
+	api.log(req).WithField("username", usersautoAdded.Username).Info("User registered")
 
 }
 
 // 2) POST /auth - возвращает JWT метку для зарегестрированных пользователей.
+//Неизвестный логин и неверный пароль неотличимы: 401 и code "invalid_credentials" без подробностей.
+//После max_failed_logins неудачных попыток подряд с одного IP логин блокируется для этого IP
+//на lockout_duration - 429, Retry-After и code "login_locked". Каждая попытка пишется
+//в login_attempts, в том числе некорректные (malformed). Отбитые лимитом запросов не пишутся,
+//они считаются в метрике apiserver_rate_limited_requests_total.
 func (api *APIServer) PostToAuth(writer http.ResponseWriter, req *http.Request) {
-	initHeaders(writer)
-	api.logger.Info("Post to Auth POST /api/v1/user/auth")
 	var userFromJson models.Usersauto
-	err := json.NewDecoder(req.Body).Decode(&userFromJson)
 	//Обрабатываем случай, если json - вовсе не json или в нем какие-либо пробелмы
+	if err := api.decodeJSON(writer, req, &userFromJson); err != nil {
+		api.recordLogin(req, userFromJson.Username, models.LoginMalformed)
+		api.writeError(writer, req, err)
+		return
+	}
+	//Попытка записывается до проверки пароля - параллельные попытки видят друг друга
+	attempt, retryAfter, err := api.startLogin(req, userFromJson.Username)
 	if err != nil {
-		api.logger.Info("Invalid json recieved from client")
-		msg := Message{
-			StatusCode: 400,
-			Message:    "Provided json is invalid",
-			IsError:    true,
-		}
-		writer.WriteHeader(400)
-		json.NewEncoder(writer).Encode(msg)
+		api.writeError(writer, req, err)
+		return
+	}
+	if retryAfter > 0 {
+		api.metrics.AuthOutcome(metrics.AuthLoginLocked)
+		api.writeLocked(writer, req, retryAfter)
 		return
 	}
 	//Необходимо попытаться обнаружить пользователя с таким login в бд
-	userInDB, ok, err := api.store.Usersauto().FindByUsername(userFromJson.Username)
+	userInDB, err := api.store.Usersauto().FindByUsername(req.Context(), userFromJson.Username)
+	//Если подключение удалось , но пользователя с таким логином нет - проверяем пароль вхолостую,
+	//чтобы по времени ответа нельзя было узнать, есть ли такой логин
+	if errors.Is(err, store.ErrNotFound) {
+		models.DummyComparePassword(userFromJson.Password)
+		api.finishLogin(req, attempt, models.LoginUnknownUser)
+		api.metrics.AuthOutcome(metrics.AuthLoginFailed)
+		api.writeError(writer, req, errInvalidCredentials)
+		return
+	}
 	// Проблема доступа к бд
 	if err != nil {
-		api.logger.Info("Can not make user search in database:", err)
-		msg := Message{
-			StatusCode: 500,
-			Message:    "We have some troubles while accessing database",
-			IsError:    true,
+		api.finishLogin(req, attempt, models.LoginError)
+		api.writeError(writer, req, err)
+		return
+	}
+	//Если пользователь с таким логином ест ьв бд - проверим, что у него пароль совпадает с фактическим
+	if !userInDB.ComparePassword(userFromJson.Password) {
+		api.finishLogin(req, attempt, models.LoginBadPassword)
+		api.metrics.AuthOutcome(metrics.AuthLoginFailed)
+		api.writeError(writer, req, errInvalidCredentials)
+		return
+	}
+	api.finishLogin(req, attempt, models.LoginSucceeded)
+	//Старые пароли в открытом виде хешируем при первом успешном входе
+	if userInDB.PasswordNeedsRehash() {
+		userInDB.Password = userFromJson.Password
+		if err := api.store.Usersauto().UpdatePassword(req.Context(), userInDB); err != nil {
+			api.log(req).WithError(err).Warn("Can not rehash password of user ", userInDB.Username)
 		}
-		writer.WriteHeader(500)
-		json.NewEncoder(writer).Encode(msg)
+	}
+
+	//Теперь выбиваем пару токенов как знак успешной аутентифкации
+	tokens, err := api.issueTokens(req.Context(), userInDB)
+	//В случае, если токен выбить не удалось!
+	if err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
+	//В случае, если токен успешно выбит - отдаем его клиенту
+	api.metrics.AuthOutcome(metrics.AuthIssued)
+	writeJSON(writer, 201, tokens)
 
-	//Если подключение удалось , но пользователя с таким логином нет
-	if !ok {
-		api.logger.Info("User with that login does not exists")
-		msg := Message{
-			StatusCode: 400,
-			Message:    "User with that login does not exists in database. Try register first",
-			IsError:    true,
-		}
-		writer.WriteHeader(400)
-		json.NewEncoder(writer).Encode(msg)
+}
+
+// POST /auth/refresh - обменивает refresh токен на новую пару токенов. Каждый refresh токен
+//одноразовый: повторное предъявление уже использованного токена отзывает все токены пользователя.
+func (api *APIServer) PostRefresh(writer http.ResponseWriter, req *http.Request) {
+	var body RefreshRequest
+	if err := api.decodeJSON(writer, req, &body); err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
-	//Если пользователь с таким логином ест ьв бд - проверим, что у него пароль совпадает с фактическим
-	if userInDB.Password != userFromJson.Password {
-		api.logger.Info("Invalid credetials to auth")
-		msg := Message{
-			StatusCode: 404,
-			Message:    "Your password is invalid",
-			IsError:    true,
+	if body.RefreshToken == "" {
+		api.writeError(writer, req, errInvalidJSON.WithDetail("refresh_token is required"))
+		return
+	}
+
+	now := time.Now()
+	hash := hashRefreshToken(body.RefreshToken)
+	token, err := api.store.RefreshTokens().Use(req.Context(), hash, now)
+	if errors.Is(err, store.ErrNotFound) {
+		//Уже использованный токен - признак кражи: отзываем все refresh токены пользователя
+		if used, err := api.store.RefreshTokens().FindByHash(req.Context(), hash); err == nil && used.UsedAt != nil {
+			api.log(req).WithField("username", used.Username).Warn("Refresh token reused, revoking all refresh tokens of the user")
+			if err := api.store.RefreshTokens().RevokeByUsername(req.Context(), used.Username, now); err != nil {
+				api.log(req).WithError(err).Warn("Can not revoke refresh tokens")
+			}
 		}
-		writer.WriteHeader(404)
-		json.NewEncoder(writer).Encode(msg)
+		api.metrics.AuthOutcome(metrics.AuthRefreshRejected)
+		api.writeError(writer, req, errInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
 
-	//Теперь выбиваем токен как знак успешной аутентифкации
-	token := jwt.New(jwt.SigningMethodHS256)             // Тот же метод подписания токена, что и в JwtMiddleware.go
-	claims := token.Claims.(jwt.MapClaims)               // Дополнительные действия (в формате мапы) для шифрования
-	claims["exp"] = time.Now().Add(time.Hour * 2).Unix() //Время жизни токена
-	claims["admin"] = true
-	claims["name"] = userInDB.Username
-	tokenString, err := token.SignedString(middleware.SecretKey)
-	//В случае, если токен выбить не удалось!
+	userInDB, err := api.store.Usersauto().FindByUsername(req.Context(), token.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		api.metrics.AuthOutcome(metrics.AuthRefreshRejected)
+		api.writeError(writer, req, errInvalidRefreshToken)
+		return
+	}
 	if err != nil {
-		api.logger.Info("Can not claim jwt-token")
-		msg := Message{
-			StatusCode: 500,
-			Message:    "We have some troubles. Try again",
-			IsError:    true,
+		api.writeError(writer, req, err)
+		return
+	}
+
+	tokens, err := api.issueTokens(req.Context(), userInDB)
+	if err != nil {
+		api.writeError(writer, req, err)
+		return
+	}
+	api.metrics.AuthOutcome(metrics.AuthRefreshed)
+	writeJSON(writer, 201, tokens)
+}
+
+// POST /auth/logout - отзывает текущий access токен и переданный refresh токен.
+//Без refresh токена в теле отзываются все refresh токены пользователя.
+func (api *APIServer) PostLogout(writer http.ResponseWriter, req *http.Request) {
+	var body RefreshRequest
+	//Тело необязательное
+	if err := api.decodeJSON(writer, req, &body); err != nil && err != errEmptyBody {
+		api.writeError(writer, req, err)
+		return
+	}
+
+	now := time.Now()
+	claims := middleware.Claims(req)
+	username, _ := claims["name"].(string)
+	err := api.revokeAccessToken(req.Context(), claims)
+	if err == nil && body.RefreshToken != "" {
+		var token *models.RefreshToken
+		token, err = api.store.RefreshTokens().FindByHash(req.Context(), hashRefreshToken(body.RefreshToken))
+		if err == nil && token.Username == username {
+			_, err = api.store.RefreshTokens().Use(req.Context(), token.TokenHash, now)
 		}
-		writer.WriteHeader(500)
-		json.NewEncoder(writer).Encode(msg)
+		//Неизвестный или уже использованный токен и так не действует
+		if errors.Is(err, store.ErrNotFound) {
+			err = nil
+		}
+	} else if err == nil {
+		err = api.store.RefreshTokens().RevokeByUsername(req.Context(), username, now)
+	}
+	if err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
-	//В случае, если токен успешно выбит - отдаем его клиенту
-	msg := Message{
-		StatusCode: 201,
-		Message:    tokenString,
+
+	writeJSON(writer, 200, Message{
+		StatusCode: 200,
+		Message:    "Logged out",
 		IsError:    false,
+	})
+}
+
+// GET /.well-known/jwks.json - публичные ключи, которыми можно проверить наши токены
+func (api *APIServer) GetJWKS(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(writer, 200, api.jwt.Keys().JWKS())
+}
+
+// PUT /admin/users/<username>/role - выдает пользователю роль {"role": "viewer|editor|admin"}.
+//Роль проверяется по БД на каждом запросе, так что она действует сразу. Refresh токены пользователя
+//отзываются, чтобы и claim role в токенах обновился.
+func (api *APIServer) PutUserRole(writer http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Role string `json:"role"`
 	}
-	writer.WriteHeader(201)
-	json.NewEncoder(writer).Encode(msg)
+	if err := api.decodeJSON(writer, req, &body); err != nil {
+		api.writeError(writer, req, err)
+		return
+	}
+	if !models.ValidRole(body.Role) {
+		api.writeError(writer, req, errInvalidRole.WithDetail(fmt.Sprintf("Unknown role %q", body.Role)))
+		return
+	}
+	api.setUserRole(writer, req, mux.Vars(req)["username"], body.Role)
+}
+
+// DELETE /admin/users/<username>/role - отзывает выданную роль, пользователь снова viewer.
+func (api *APIServer) DeleteUserRole(writer http.ResponseWriter, req *http.Request) {
+	api.setUserRole(writer, req, mux.Vars(req)["username"], models.RoleViewer)
+}
+
+func (api *APIServer) setUserRole(writer http.ResponseWriter, req *http.Request, username string, role string) {
+	err := api.store.Usersauto().UpdateRole(req.Context(), username, role)
+	if err == nil {
+		err = api.store.RefreshTokens().RevokeByUsername(req.Context(), username, time.Now())
+	}
+	if err != nil {
+		api.writeError(writer, req, err)
+		return
+	}
+	api.log(req).WithFields(logrus.Fields{"username": username, "role": role}).Info("Role of user changed")
+	writeJSON(writer, 200, Message{
+		StatusCode: 200,
+		Message:    fmt.Sprintf("User %s now has role %s", username, role),
+		IsError:    false,
+	})
+}
 
+// GET /admin/login-attempts - попытки входа, новые первыми. Фильтры username, ip, outcome,
+//since и until (RFC 3339), limit (по умолчанию 100) и offset.
+func (api *APIServer) GetLoginAttempts(writer http.ResponseWriter, req *http.Request) {
+	q, err := parseLoginAttemptsQuery(req.URL.Query())
+	if err != nil {
+		api.writeError(writer, req, errInvalidQuery.WithDetail(err.Error()))
+		return
+	}
+	attempts, err := api.store.LoginAttempts().Select(req.Context(), q)
+	if err != nil {
+		api.writeError(writer, req, err)
+		return
+	}
+	writeJSON(writer, 200, attempts)
 }
 
 // 3) GET /auto/<string:mark> - возвращает информацию про автомобиль с именем mark и код 200.
-//В случае, если автомобиля нет в БД в текущий момент возвращаем {"Error" : "Auto with
-//that mark not found"} и код 404.
+//Версия автомобиля приходит в ETag, с совпавшим If-None-Match - 304 без тела.
+//В случае, если автомобиля нет в БД в текущий момент возвращаем 404 и code "not_found".
 func (api *APIServer) GetAutoByMark(writer http.ResponseWriter, req *http.Request) {
-	initHeaders(writer)
-	api.logger.Info("Get AutoByMark /api/v1/auto/{mark}")
 	mark := mux.Vars(req)["mark"]
 
-	auto, ok, err := api.store.Automobiles().FindAutomobileByMark(mark)
+	auto, err := api.store.Automobiles().FindAutomobileByMark(req.Context(), mark)
 	if err != nil {
-		api.logger.Info("Troubles while accessing database table (articles) with id. err:", err)
-		msg := Message{
-			StatusCode: 500,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(500)
-		json.NewEncoder(writer).Encode(msg)
+		api.writeError(writer, req, err)
 		return
 	}
-	if !ok {
-		api.logger.Info("Can not find auto with that mark in database")
-		msg := Message{
-			StatusCode: 404,
-			Message:    "Auto with that mark not found",
-			IsError:    true,
-		}
-
-		writer.WriteHeader(404)
-		json.NewEncoder(writer).Encode(msg)
+	writer.Header().Set("ETag", etag(auto))
+	//Клиент уже видел эту версию
+	if ifNoneMatch(req, auto) {
+		writer.WriteHeader(http.StatusNotModified)
 		return
 	}
-	writer.WriteHeader(200)
-	json.NewEncoder(writer).Encode(auto)
+	writeJSON(writer, 200, auto)
 
 }
 
 // 4) POST /auto/<string:mark> - добавляет автомобиль с именем mark в БД. В случае успеха - 201 и
-//сообщение {"Message" : "Auto created"}. В случае, если автомобиль с таким именем уже
-//существует - 400 и {"Error" : "Auto with that mark exists"}.
+//созданный автомобиль. В случае, если автомобиль с таким именем уже
+//существует - 409 и code "conflict".
 func (api *APIServer) PostAuto(writer http.ResponseWriter, req *http.Request) {
-	initHeaders(writer)
-	api.logger.Info("Post auto POST /auto/<mark>")
 	mark := mux.Vars(req)["mark"]
 	var auto models.Automobiles
-	err := json.NewDecoder(req.Body).Decode(&auto)
-	if err != nil {
-		api.logger.Info("Invalid json recieved from client")
-		msg := Message{
-			StatusCode: 400,
-			Message:    "Provided json is invalid",
-			IsError:    true,
-		}
-		writer.WriteHeader(400)
-		json.NewEncoder(writer).Encode(msg)
+	if err := api.decodeJSON(writer, req, &auto); err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
 
-	_, ok, err := api.store.Automobiles().FindAutomobileByMark(mark)
-	if err != nil {
-		api.logger.Info("Troubles while accessing database table (articles) with id. err:", err)
-		msg := Message{
-			StatusCode: 500,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(500)
-		json.NewEncoder(writer).Encode(msg)
-		return
-	}
-	if ok {
-		api.logger.Info("Can find auto with that mark in database")
-		msg := Message{
-			StatusCode: 404,
-			Message:    "Auto with that mark exists",
-			IsError:    true,
-		}
-		writer.WriteHeader(404)
-		json.NewEncoder(writer).Encode(msg)
+	auto.Mark = mark
+	if err := auto.Validate(); err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
-
-	auto.Mark = mark
-	a, err := api.store.Automobiles().Create(&auto)
+	//Дубликат марки отсекает уникальный индекс - store.ErrConflict
+	a, err := api.store.Automobiles().Create(req.Context(), &auto)
 	if err != nil {
-		api.logger.Info("Troubles while creating new article:", err)
-		msg := Message{
-			StatusCode: 501,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(501)
-		json.NewEncoder(writer).Encode(msg)
+		api.writeError(writer, req, err)
 		return
 	}
-	writer.WriteHeader(201)
-	json.NewEncoder(writer).Encode(a)
+	writer.Header().Set("ETag", etag(a))
+	writeJSON(writer, 201, a)
 }
 
 // 5) PUT /auto/<string:mark> - обновляет информацию про автомобиль с именем mark в БД. В
 //случае успеха - 202 и сообщение {"Message" : "Auto updated"}. В случае, если автомобиля нет
-//в БД в текущий момент возвращаем {"Error" : "Auto with that mark not found"} и код 404.
+//в БД в текущий момент возвращаем 404 и code "not_found". Другой mark в теле переименовывает
+//автомобиль, новый адрес приходит в Location; занятая марка - 409 и code "conflict".
+//С If-Match обновляет только ту версию (ETag), иначе 412 и code "precondition_failed".
 func (api *APIServer) PutAuto(writer http.ResponseWriter, req *http.Request) {
-	initHeaders(writer)
-	api.logger.Info("Put Auto by mark  /api/v1/auto/{mark}")
 	// scan mark
 	mark := mux.Vars(req)["mark"]
 
-	// find artilce by mark
-	_, ok, err := api.store.Automobiles().FindAutomobileByMark(mark)
-	if err != nil {
-		api.logger.Info("Troubles while accessing database table (automobiles) with id. err:", err)
-		msg := Message{
-			StatusCode: 500,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(500)
-		json.NewEncoder(writer).Encode(msg)
+	// get data for update
+	var newAuto models.Automobiles
+	if err := api.decodeJSON(writer, req, &newAuto); err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
-	if !ok {
-		api.logger.Info("Can not find auto with that ID in database")
-		msg := Message{
-			StatusCode: 404,
-			Message:    "Auto with that mark not found",
-			IsError:    true,
-		}
-		writer.WriteHeader(404)
-		json.NewEncoder(writer).Encode(msg)
+	//Другая марка в теле переименовывает автомобиль
+	if newAuto.Mark == "" {
+		newAuto.Mark = mark
+	}
+	if err := newAuto.Validate(); err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
-	// get data for update
-	var newAuto models.Automobiles
-	err = json.NewDecoder(req.Body).Decode(&newAuto)
-	if err != nil {
-		api.logger.Info("Invalid json recieved from client")
-		msg := Message{
-			StatusCode: 400,
-			Message:    "Provided json is invalid",
-			IsError:    true,
-		}
 
-		writer.WriteHeader(400)
-		json.NewEncoder(writer).Encode(msg)
+	version, err := api.ifMatchVersion(req, mark)
+	if err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
-
-	a, err := api.store.Automobiles().UpdateByMark(mark, &newAuto)
+	a, err := api.store.Automobiles().UpdateByMark(req.Context(), mark, &newAuto, version)
 	if err != nil {
-		api.logger.Info("Troubles while creating new article:", err)
-		msg := Message{
-			StatusCode: 501,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(501)
-		json.NewEncoder(writer).Encode(msg)
+		api.writeError(writer, req, err)
 		return
 	}
-	api.logger.Info("Auto updated Mark:", a)
-	msg := Message{
+	api.log(req).WithField("mark", a.Mark).Info("Auto updated")
+	writer.Header().Set("ETag", etag(a))
+	if a.Mark != mark {
+		writer.Header().Set("Location", prefix+"/auto/"+a.Mark)
+	}
+	writeJSON(writer, 202, Message{
 		StatusCode: 202,
 		Message:    "Auto updated",
 		IsError:    false,
-	}
-	writer.WriteHeader(202)
-	json.NewEncoder(writer).Encode(msg)
+	})
 
 }
 
 // 6) DELETE /auto/<string:mark> - удаляет информацию про автомобиль с именем mark из БД. В
 //случае успеха - 202 и сообщение {"Message" : "Auto deleted"}. В случае, если автомобиля нет
-//в БД в текущий момент возвращаем {"Error" : "Auto with that mark not found"} и код 404.
+//в БД в текущий момент возвращаем 404 и code "not_found". If-Match - как у PUT.
 func (api *APIServer) DeleteAuto(writer http.ResponseWriter, req *http.Request) {
-	initHeaders(writer)
-	api.logger.Info("Delete Auto by mark DELETE /api/v1/auto/<string:mark>")
 	// scan mark
 	mark := mux.Vars(req)["mark"]
 
-	_, ok, err := api.store.Automobiles().FindAutomobileByMark(mark)
+	version, err := api.ifMatchVersion(req, mark)
 	if err != nil {
-		api.logger.Info("Troubles while accessing database table (automobiles) with id. err:", err)
-		msg := Message{
-			StatusCode: 500,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(500)
-		json.NewEncoder(writer).Encode(msg)
+		api.writeError(writer, req, err)
 		return
 	}
-
-	if !ok {
-		api.logger.Info("Auto with that mark not found in database")
-		msg := Message{
-			StatusCode: 404,
-			Message:    "Auto with that mark not found",
-			IsError:    true,
-		}
-
-		writer.WriteHeader(404)
-		json.NewEncoder(writer).Encode(msg)
+	if err := api.store.Automobiles().DeleteByMark(req.Context(), mark, version); err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
 
-	_, err = api.store.Automobiles().DeleteByMark(mark)
-	if err != nil {
-		api.logger.Info("Troubles while deleting database elemnt from table (automobiles) with id. err:", err)
-		msg := Message{
-			StatusCode: 501,
-			Message:    "We have some troubles to accessing database. Try again",
-			IsError:    true,
-		}
-		writer.WriteHeader(501)
-		json.NewEncoder(writer).Encode(msg)
-		return
-	}
-	writer.WriteHeader(202)
-	msg := Message{
+	writeJSON(writer, 202, Message{
 		StatusCode: 202,
-		Message:    fmt.Sprintf("Article with mark %s successfully deleted.", mark),
+		Message:    fmt.Sprintf("Auto with mark %s successfully deleted.", mark),
 		IsError:    false,
-	}
-	json.NewEncoder(writer).Encode(msg)
+	})
 
 }
 
-// 7) GET /stock - возвращает информацию про все имеющиеся на данный момент в БД автомобили
-// и код 200 в случае, если имеется хотя бы один автомобиль в наличии. В противном случае - 400 и
-// сообщение {"Error" : "No one autos found in DataBase"}.
+// 7) GET /stock - возвращает информацию про имеющиеся на данный момент в БД автомобили
+// и код 200. Если под фильтры ничего не попало - 200 и пустой массив.
 func (api *APIServer) GetAllAutos(writer http.ResponseWriter, req *http.Request) {
-	initHeaders(writer)
-	api.logger.Info("Get all Automobiles GET /api/v1/stock")
 
-	automobiles, err := api.store.Automobiles().SelectAll()
+	query, err := parseAutomobilesQuery(req.URL.Query())
 	if err != nil {
-		api.logger.Info(err)
-		msg := Message{
-			StatusCode: 501,
-			Message:    "We have some troubles to accessing articles in database. Try later",
-			IsError:    true,
-		}
-		writer.WriteHeader(501)
-		json.NewEncoder(writer).Encode(msg)
+		api.writeError(writer, req, errInvalidQuery.WithDetail(err.Error()))
 		return
 	}
 
-	if len(automobiles) == 0 {
-		msg := Message{
-			StatusCode: 400,
-			Message:    "No one autos found in DataBase",
-			IsError:    false,
-		}
-		writer.WriteHeader(400)
-		json.NewEncoder(writer).Encode(msg)
+	page, err := api.store.Automobiles().SelectPage(req.Context(), query)
+	if err != nil {
+		api.writeError(writer, req, err)
 		return
 	}
 
-	api.logger.Info("Get All Articles GET  /api/v1/stock")
-	writer.WriteHeader(http.StatusOK)
-	json.NewEncoder(writer).Encode(automobiles)
+	//Paging metadata goes to headers, so the body stays a plain array
+	writer.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		next := *req.URL
+		values := next.Query()
+		values.Del("offset")
+		values.Set("cursor", page.NextCursor)
+		next.RawQuery = values.Encode()
+		writer.Header().Set("X-Next-Cursor", page.NextCursor)
+		writer.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	writeJSON(writer, http.StatusOK, page.Automobiles)
 }
 
 /*
@@ -0,0 +1,144 @@
+package apiserver
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Konatavi/go2HW2/store"
+)
+
+// Health statuses
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// HealthCheck is the status of one dependency in /readyz.
+// /readyz is public, so why a check failed goes to the log only
+type HealthCheck struct {
+	Status  string `json:"status"`
+	err     error
+	latency time.Duration
+}
+
+// PoolStats is sql.DBStats of the store connection pool, served to admins at /admin/pool.
+// Saturated means every allowed connection is in use and new queries wait.
+type PoolStats struct {
+	MaxOpen           int   `json:"max_open"`
+	Open              int   `json:"open"`
+	InUse             int   `json:"in_use"`
+	Idle              int   `json:"idle"`
+	WaitCount         int64 `json:"wait_count"`
+	WaitDurationMS    int64 `json:"wait_duration_ms"`
+	MaxIdleClosed     int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+	Saturated         bool  `json:"saturated"`
+}
+
+// Health is the body of /healthz and /readyz
+type Health struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// GET /healthz - процесс жив. Зависимости не проверяет
+func (api *APIServer) GetHealthz(writer http.ResponseWriter, req *http.Request) {
+	initHeaders(writer)
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(Health{Status: statusOK})
+}
+
+// GET /readyz - можно ли направлять трафик: БД доступна и схема нужной версии.
+// 200 если все проверки прошли, иначе 503
+func (api *APIServer) GetReadyz(writer http.ResponseWriter, req *http.Request) {
+	initHeaders(writer)
+	ctx, cancel := context.WithTimeout(req.Context(), api.config().ReadinessTimeout)
+	defer cancel()
+
+	health := Health{
+		Status: statusOK,
+		Checks: map[string]*HealthCheck{
+			"database":   api.checkDatabase(ctx),
+			"migrations": api.checkMigrations(ctx),
+		},
+	}
+	code := 200
+	for name, check := range health.Checks {
+		if check.Status != statusOK {
+			api.log(req).WithField("check", name).Warn("Readiness check failed after ", check.latency, ": ", check.err)
+			health.Status = statusFail
+			code = 503
+		} else {
+			api.log(req).WithField("check", name).Debug("Readiness check passed in ", check.latency)
+		}
+	}
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(code)
+	json.NewEncoder(writer).Encode(health)
+}
+
+func (api *APIServer) checkDatabase(ctx context.Context) *HealthCheck {
+	start := time.Now()
+	err := api.store.Ping(ctx)
+	check := newHealthCheck(start, err)
+	if api.config().Store.Driver != store.DriverMemory {
+		if pool := newPoolStats(api.store.Stats()); pool.Saturated {
+			api.logger.Warn("db pool is saturated: ", pool.InUse, " of ", pool.MaxOpen, " connections in use, ", pool.WaitCount, " queries waited")
+		}
+	}
+	return check
+}
+
+// GET /admin/pool - статистика пула соединений с БД, только для администраторов
+func (api *APIServer) GetPoolStats(writer http.ResponseWriter, req *http.Request) {
+	initHeaders(writer)
+	api.logger.Info("Get pool stats GET /api/v1/admin/pool")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(newPoolStats(api.store.Stats()))
+}
+
+func newPoolStats(stats sql.DBStats) *PoolStats {
+	return &PoolStats{
+		MaxOpen:           stats.MaxOpenConnections,
+		Open:              stats.OpenConnections,
+		InUse:             stats.InUse,
+		Idle:              stats.Idle,
+		WaitCount:         stats.WaitCount,
+		WaitDurationMS:    stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:     stats.MaxIdleClosed,
+		MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed: stats.MaxLifetimeClosed,
+		Saturated:         stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections,
+	}
+}
+
+func (api *APIServer) checkMigrations(ctx context.Context) *HealthCheck {
+	start := time.Now()
+	version, dirty, err := api.store.MigrationVersion(ctx)
+	if err == nil && dirty {
+		err = fmt.Errorf("migration %d is dirty", version)
+	}
+	//A newer schema is fine: it is left by the next release during a rolling update
+	if err == nil && version < store.SchemaVersion {
+		err = fmt.Errorf("schema version is %d, want at least %d", version, store.SchemaVersion)
+	}
+	return newHealthCheck(start, err)
+}
+
+func newHealthCheck(start time.Time, err error) *HealthCheck {
+	check := &HealthCheck{
+		Status:  statusOK,
+		err:     err,
+		latency: time.Since(start),
+	}
+	if err != nil {
+		check.Status = statusFail
+	}
+	return check
+}
@@ -0,0 +1,62 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+func TestReadyz(t *testing.T) {
+	s := newTestServer(t, nil)
+	rec := do(s, "GET", "/readyz", "", nil, "192.0.2.1:1234")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	want := `{"status":"ok","checks":{"database":{"status":"ok"},"migrations":{"status":"ok"}}}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestFailedHealthCheckHidesError(t *testing.T) {
+	check := newHealthCheck(time.Now(), errors.New(`pq: password authentication failed for user "postgres"`))
+	if check.Status != statusFail {
+		t.Fatalf("got status %s", check.Status)
+	}
+	health := Health{Status: statusFail, Checks: map[string]*HealthCheck{"database": check}}
+	raw, err := json.Marshal(health)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "postgres") {
+		t.Fatalf("readyz body tells the error: %s", raw)
+	}
+}
+
+func TestPoolStatsAdminOnly(t *testing.T) {
+	s := newTestServer(t, nil)
+	viewer := tokenFor(t, s, "viewer", models.RoleViewer)
+	admin := tokenFor(t, s, "admin", models.RoleAdmin)
+	if rec := do(s, "GET", "/api/v1/admin/pool", "", nil, "192.0.2.1:1234"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous got %d", rec.Code)
+	}
+	if rec := do(s, "GET", "/api/v1/admin/pool", "", bearer(viewer), "192.0.2.1:1234"); rec.Code != http.StatusForbidden {
+		t.Fatalf("viewer got %d", rec.Code)
+	}
+	rec := do(s, "GET", "/api/v1/admin/pool", "", bearer(admin), "192.0.2.1:1234")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin got %d: %s", rec.Code, rec.Body)
+	}
+	var stats PoolStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(do(s, "GET", "/readyz", "", nil, "192.0.2.1:1234").Body.String(), "pool") {
+		t.Fatal("readyz tells the pool stats")
+	}
+}
@@ -0,0 +1,171 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/internal/app/ratelimit"
+	"github.com/Konatavi/go2HW2/store"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client chosen key of a request that may be retried
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from an earlier request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// idempotencyScopeAnonymous is the scope of keys sent without a token, e.g. to /register
+	idempotencyScopeAnonymous = "anonymous"
+)
+
+// replayedHeaders describe the stored response itself and are the only headers saved with it.
+// Headers of the request that made it, e.g. X-Request-ID or RateLimit-*, are never replayed
+var replayedHeaders = []string{"Content-Type", "ETag", "Location", "Cache-Control"}
+
+// idempotent makes retries of h with the same Idempotency-Key safe. The first response for
+// a key of a user is stored for idempotency_ttl and replayed for retries with the same body.
+// While the first request runs, the key is leased for write_timeout only, so a key left behind
+// by a crash is free again soon. Requests without the header are passed through.
+func (api *APIServer) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			h(writer, req)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			api.writeError(writer, req, errInvalidIdempotencyKey.WithDetail(fmt.Sprintf("key must not be longer than %d characters", maxIdempotencyKeyLength)))
+			return
+		}
+		//The body is read once for the fingerprint and handed to h again
+		cfg := api.config()
+		body, err := io.ReadAll(http.MaxBytesReader(writer, req.Body, cfg.MaxBodyBytes))
+		if err != nil {
+			api.writeError(writer, req, decodeError(err, cfg.MaxBodyBytes))
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		hash := requestHash(req, body)
+		k := &models.IdempotencyKey{
+			Scope:       api.idempotencyScope(req, hash),
+			Key:         key,
+			RequestHash: hash,
+			ExpiresAt:   now.Add(cfg.WriteTimeout),
+		}
+		stored, err := api.store.IdempotencyKeys().Start(req.Context(), k, now)
+		//The stored key may expire between the insert and the lookup, then it is free again
+		if errors.Is(err, store.ErrNotFound) {
+			stored, err = api.store.IdempotencyKeys().Start(req.Context(), k, now)
+		}
+		switch {
+		case errors.Is(err, store.ErrConflict) && stored.RequestHash != k.RequestHash:
+			api.writeError(writer, req, errIdempotencyKeyReused.WithDetail("use a new key for a request with a different body"))
+			return
+		case errors.Is(err, store.ErrConflict) && !stored.Completed():
+			api.writeError(writer, req, errIdempotencyKeyInUse.WithDetail("retry later"))
+			return
+		case errors.Is(err, store.ErrConflict):
+			api.log(req).WithField("idempotency_key", key).Info("Replaying stored response")
+			replay(writer, stored)
+			return
+		case err != nil:
+			api.writeError(writer, req, err)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+		h(rec, req)
+
+		//The client may be gone already, the outcome is saved anyway
+		ctx := context.WithoutCancel(req.Context())
+		if rec.status >= http.StatusInternalServerError {
+			//Failures are not remembered, so a retry runs the request again
+			err = api.store.IdempotencyKeys().Delete(ctx, k.Scope, k.Key)
+		} else {
+			k.StatusCode = rec.status
+			k.ExpiresAt = time.Now().Add(cfg.IdempotencyTTL)
+			k.ResponseHeader = rec.header
+			k.ResponseBody = rec.body.Bytes()
+			err = api.store.IdempotencyKeys().Complete(ctx, k)
+		}
+		if err != nil {
+			api.log(req).WithError(err).WithField("idempotency_key", key).Error("Can not save idempotency key")
+		}
+	}
+}
+
+// idempotencyScope keeps keys of different clients apart. Users are told apart by their token.
+// Anonymous clients, e.g. of /register, by their address and the request fingerprint, so one
+// client can neither replay nor block the key of another. Such a scope is longer than any username.
+func (api *APIServer) idempotencyScope(req *http.Request, requestHash string) string {
+	if name, _ := middleware.Claims(req)["name"].(string); name != "" {
+		return name
+	}
+	return idempotencyScopeAnonymous + ":" + ratelimit.ClientIP(req, api.limiter.TrustProxy()) + ":" + requestHash
+}
+
+// requestHash fingerprints a request, a retry must have the same method, path and body
+func requestHash(req *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, req.Method+" "+req.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(writer http.ResponseWriter, k *models.IdempotencyKey) {
+	for name, values := range representationHeaders(k.ResponseHeader) {
+		writer.Header()[name] = values
+	}
+	writer.Header().Set(IdempotentReplayedHeader, "true")
+	writer.WriteHeader(k.StatusCode)
+	writer.Write(k.ResponseBody)
+}
+
+// responseRecorder passes the response through and keeps a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+	r.header = representationHeaders(r.ResponseWriter.Header())
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// representationHeaders copies the replayedHeaders of h
+func representationHeaders(h http.Header) http.Header {
+	kept := make(http.Header)
+	for _, name := range replayedHeaders {
+		if values := h.Values(name); len(values) > 0 {
+			kept[name] = append([]string(nil), values...)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,158 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+const registerBody = `{"username":"alice","password":"password1"}`
+
+func TestIdempotentReplay(t *testing.T) {
+	s := newTestServer(t, nil)
+	send := func(requestID string) *http.Response {
+		header := http.Header{}
+		header.Set(IdempotencyKeyHeader, "k1")
+		header.Set(middleware.RequestIDHeader, requestID)
+		return do(s, "POST", prefix+"/register", registerBody, header, "10.0.0.1:1234").Result()
+	}
+	first, retry := send("first"), send("retry")
+
+	if first.StatusCode != http.StatusCreated || retry.StatusCode != http.StatusCreated {
+		t.Fatalf("got %d and %d, want 201 twice", first.StatusCode, retry.StatusCode)
+	}
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{IdempotentReplayedHeader, "true"},
+		{"Content-Type", first.Header.Get("Content-Type")},
+		{middleware.RequestIDHeader, "retry"},
+		//The bucket of the retry, not the one stored with the first response
+		{"RateLimit-Remaining", "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := retry.Header.Get(tt.header); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if first.Header.Get(IdempotentReplayedHeader) != "" {
+		t.Fatal("first response is marked as replayed")
+	}
+}
+
+func TestIdempotentReplayHeaders(t *testing.T) {
+	s := newTestServer(t, nil)
+	send := func(requestID string) *http.Response {
+		header := http.Header{}
+		header.Set(IdempotencyKeyHeader, "k1")
+		header.Set(middleware.RequestIDHeader, requestID)
+		return do(s, "POST", prefix+"/register", registerBody, header, "10.0.0.1:1234").Result()
+	}
+	first, retry := send("first"), send("retry")
+
+	if first.StatusCode != http.StatusCreated || retry.StatusCode != http.StatusCreated {
+		t.Fatalf("got %d and %d, want 201 twice", first.StatusCode, retry.StatusCode)
+	}
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{IdempotentReplayedHeader, "true"},
+		{"Content-Type", first.Header.Get("Content-Type")},
+		{middleware.RequestIDHeader, "retry"},
+		//The bucket of the retry, not the one stored with the first response
+		{"RateLimit-Remaining", "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := retry.Header.Get(tt.header); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdempotentKeyReusedForAnotherBody(t *testing.T) {
+	s := newTestServer(t, nil)
+	header := bearer(tokenFor(t, s, "editor", models.RoleEditor))
+	header.Set(IdempotencyKeyHeader, "k1")
+	if rec := do(s, "POST", prefix+"/auto/bmw", `{"max_speed": 250}`, header, "10.0.0.1:1234"); rec.Code != http.StatusCreated {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(s, "POST", prefix+"/auto/bmw", `{"max_speed": 260}`, header, "10.0.0.1:1234"); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestIdempotentAnonymousScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		body       string
+		// want is the status of the second request, replayed is whether it was replayed
+		want     int
+		replayed bool
+	}{
+		{"same client retries", "10.0.0.1:1234", registerBody, http.StatusCreated, true},
+		{"same client on another port", "10.0.0.1:5678", registerBody, http.StatusCreated, true},
+		{"other client, same key and body", "10.0.0.2:1234", registerBody, http.StatusConflict, false},
+		{"same client, other body", "10.0.0.1:1234", `{"username":"bob","password":"password1"}`, http.StatusCreated, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			header := http.Header{IdempotencyKeyHeader: {"k1"}}
+			if rec := do(s, "POST", prefix+"/register", registerBody, header, "10.0.0.1:1234"); rec.Code != http.StatusCreated {
+				t.Fatalf("got %d: %s", rec.Code, rec.Body)
+			}
+			rec := do(s, "POST", prefix+"/register", tt.body, header, tt.remoteAddr)
+			if rec.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if replayed := rec.Header().Get(IdempotentReplayedHeader) == "true"; replayed != tt.replayed {
+				t.Fatalf("got replayed %v", replayed)
+			}
+		})
+	}
+}
+
+func TestIdempotentInProgressLease(t *testing.T) {
+	tests := []struct {
+		name string
+		// lease left of the key reserved by an earlier request that never finished
+		lease time.Duration
+		want  int
+	}{
+		{"lease running", time.Minute, http.StatusConflict},
+		{"lease expired", -time.Second, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			req, _ := http.NewRequest("POST", prefix+"/register", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			hash := requestHash(req, []byte(registerBody))
+			now := time.Now()
+			_, err := s.store.IdempotencyKeys().Start(context.Background(), &models.IdempotencyKey{
+				Scope:       s.idempotencyScope(req, hash),
+				Key:         "k1",
+				RequestHash: hash,
+				ExpiresAt:   now.Add(tt.lease),
+			}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := do(s, "POST", prefix+"/register", registerBody, http.Header{IdempotencyKeyHeader: {"k1"}}, "10.0.0.1:1234")
+			if rec.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
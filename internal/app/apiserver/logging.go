@@ -0,0 +1,65 @@
+package apiserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// Supported log formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// log is the logger of the request, it carries the request id, route and user
+func (api *APIServer) log(req *http.Request) *logrus.Entry {
+	if entry := middleware.LogEntry(req.Context()); entry != nil {
+		return entry
+	}
+	return logrus.NewEntry(api.logger)
+}
+
+// setLogFormat applies log_format to the server log. Access lines are always JSON
+func (s *APIServer) setLogFormat(format string) {
+	if format == logFormatJSON {
+		s.logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		s.logger.SetFormatter(&logrus.TextFormatter{})
+	}
+}
+
+// setLogFile sends the server log and the access lines to path, or to stderr if path is empty.
+// The previous log file is closed.
+func (s *APIServer) setLogFile(path string) error {
+	var out io.Writer = os.Stderr
+	var file *os.File
+	if path != "" {
+		var err error
+		if file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			return fmt.Errorf("log_file: %w", err)
+		}
+		out = file
+	}
+	s.logger.SetOutput(out)
+	s.accessLogger.SetOutput(out)
+	if s.logFile != nil {
+		s.logFile.Close()
+	}
+	s.logFile = file
+	return nil
+}
+
+// closeLogFile sends the log back to stderr and closes the log file, if any
+func (s *APIServer) closeLogFile() {
+	s.setLogFile("")
+}
+
+// unmatched logs requests no route matched like all others and passes them to h
+func (s *APIServer) unmatched(h http.Handler) http.Handler {
+	return middleware.AccessLog(s.logger, s.accessLogger)(h)
+}
@@ -0,0 +1,78 @@
+package apiserver
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/internal/app/ratelimit"
+)
+
+// Longest username and user agent written to login_attempts, the rest is cut off
+const (
+	maxAuditUsername  = 64
+	maxAuditUserAgent = 256
+)
+
+// startLogin records the attempt of username before its password is checked. It returns
+// how long username stays locked for the client IP after max_failed_logins failures in a row
+// from that IP, 0 if it may log in. Failures older than lockout_duration are forgotten.
+// Keying on the IP too keeps a guesser from locking the real user out from everywhere.
+func (api *APIServer) startLogin(req *http.Request, username string) (*models.LoginAttempt, time.Duration, error) {
+	cfg := api.config()
+	attempt := api.loginAttempt(req, username)
+	now := time.Now()
+	last, err := api.store.LoginAttempts().Start(req.Context(), attempt, cfg.MaxFailedLogins, now.Add(-cfg.LockoutDuration))
+	if err != nil || attempt.Outcome != models.LoginLocked {
+		return attempt, 0, err
+	}
+	return attempt, last.Add(cfg.LockoutDuration).Sub(now), nil
+}
+
+// finishLogin saves the outcome of an attempt made by startLogin. The audit must not break logins,
+// so a failed write is only logged
+func (api *APIServer) finishLogin(req *http.Request, attempt *models.LoginAttempt, outcome string) {
+	attempt.Outcome = outcome
+	//The client may be gone already, a pending attempt would count as a failure
+	if err := api.store.LoginAttempts().Finish(context.WithoutCancel(req.Context()), attempt); err != nil {
+		api.log(req).WithError(err).WithField("outcome", outcome).Error("Can not record login attempt")
+	}
+}
+
+// recordLogin writes an attempt that never got to the password, e.g. a malformed one
+func (api *APIServer) recordLogin(req *http.Request, username string, outcome string) {
+	attempt := api.loginAttempt(req, username)
+	attempt.Outcome = outcome
+	if _, err := api.store.LoginAttempts().Create(req.Context(), attempt); err != nil {
+		api.log(req).WithError(err).WithField("outcome", outcome).Error("Can not record login attempt")
+	}
+}
+
+func (api *APIServer) loginAttempt(req *http.Request, username string) *models.LoginAttempt {
+	return &models.LoginAttempt{
+		Username:  truncate(username, maxAuditUsername),
+		IP:        ratelimit.ClientIP(req, api.limiter.TrustProxy()),
+		UserAgent: truncate(req.UserAgent(), maxAuditUserAgent),
+	}
+}
+
+// writeLocked answers a login of a locked username
+func (api *APIServer) writeLocked(writer http.ResponseWriter, req *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	writer.Header().Set("Retry-After", strconv.Itoa(seconds))
+	api.writeError(writer, req, errLoginLocked.WithDetail("retry in "+strconv.Itoa(seconds)+" s"))
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
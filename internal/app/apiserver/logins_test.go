@@ -0,0 +1,97 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/metrics"
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/internal/app/ratelimit"
+	"github.com/Konatavi/go2HW2/store"
+)
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.RateLimit.Enabled = false
+		c.MaxFailedLogins = 2
+	})
+	tokenFor(t, s, "alice", models.RoleViewer)
+	good := `{"username":"alice","password":"password1"}`
+	bad := `{"username":"alice","password":"wrong password"}`
+
+	//The steps share the attempts and run in order
+	tests := []struct {
+		name string
+		body string
+		ip   string
+		want int
+	}{
+		{"first failure", bad, "10.0.0.1", http.StatusUnauthorized},
+		{"success resets the count", good, "10.0.0.1", http.StatusCreated},
+		{"failure after success", bad, "10.0.0.1", http.StatusUnauthorized},
+		{"second failure in a row", bad, "10.0.0.1", http.StatusUnauthorized},
+		{"locked for the ip", good, "10.0.0.1", http.StatusTooManyRequests},
+		{"not locked for another ip", good, "10.0.0.2", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(s, "POST", prefix+"/auth", tt.body, nil, tt.ip+":1234")
+			if rec.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Fatal("locked login without Retry-After")
+			}
+		})
+	}
+}
+
+func TestLoginPendingCountsAsFailure(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.RateLimit.Enabled = false
+		c.MaxFailedLogins = 1
+	})
+	tokenFor(t, s, "alice", models.RoleViewer)
+	//A parallel attempt whose password is still being checked
+	pending := &models.LoginAttempt{Username: "alice", IP: "10.0.0.1"}
+	if _, err := s.store.LoginAttempts().Start(context.Background(), pending, 1, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	rec := do(s, "POST", prefix+"/auth", `{"username":"alice","password":"password1"}`, nil, "10.0.0.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want 429: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRateLimitedLoginCounted(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.RateLimit.Routes = []ratelimit.Rule{{Route: prefix + "/auth", Requests: 1, Per: time.Hour}}
+	})
+	s.metrics = metrics.New()
+	login := `{"username":"nobody","password":"password1"}`
+	if rec := do(s, "POST", prefix+"/auth", login, nil, "10.0.0.1:1234"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("first login: got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(s, "POST", prefix+"/auth", login, nil, "10.0.0.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second login: got %d: %s", rec.Code, rec.Body)
+	}
+
+	//Only the login that got past the limiter is audited
+	attempts, err := s.store.LoginAttempts().Select(context.Background(), &store.LoginAttemptsQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 1 || attempts[0].Outcome != models.LoginUnknownUser {
+		t.Fatalf("got %d attempts, want the unknown_user one", len(attempts))
+	}
+	rec := httptest.NewRecorder()
+	s.metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := `apiserver_rate_limited_requests_total{route="` + prefix + `/auth"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("metrics lack %s", want)
+	}
+}
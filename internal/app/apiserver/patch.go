@@ -0,0 +1,117 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/store"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gorilla/mux"
+)
+
+// Patch formats accepted by PATCH /auto/<mark>. Plain application/json is a merge patch
+const (
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// patchAttempts bounds how often a PATCH without If-Match is applied again after a concurrent update
+const patchAttempts = 3
+
+// PATCH /auto/<string:mark> - меняет только переданные поля автомобиля.
+// Тело - JSON Merge Patch (RFC 7396, application/merge-patch+json) или
+// JSON Patch (RFC 6902, application/json-patch+json). Поле mark можно поменять - автомобиль переименуется.
+// В случае успеха - 200 и обновленный автомобиль. С If-Match патч применяется только к той версии, иначе 412.
+func (api *APIServer) PatchAuto(writer http.ResponseWriter, req *http.Request) {
+	mark := mux.Vars(req)["mark"]
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if contentType != contentTypeMergePatch && contentType != contentTypeJSONPatch && contentType != "application/json" {
+		writer.Header().Set("Accept-Patch", contentTypeMergePatch+", "+contentTypeJSONPatch)
+		api.writeError(writer, req, errUnsupportedMediaType.WithDetail("use "+contentTypeMergePatch+" or "+contentTypeJSONPatch))
+		return
+	}
+	patch, err := api.readBody(writer, req)
+	if err != nil {
+		api.writeError(writer, req, err)
+		return
+	}
+
+	//Патч считается от прочитанной версии и записывается только поверх нее.
+	//Без If-Match параллельную правку просто применяем заново
+	var a *models.Automobiles
+	for attempt := 1; ; attempt++ {
+		current, err := api.store.Automobiles().FindAutomobileByMark(req.Context(), mark)
+		if err != nil {
+			api.writeError(writer, req, err)
+			return
+		}
+		if !ifMatch(req, current) {
+			api.writeError(writer, req, errPreconditionFailed.WithDetail("auto has entity tag "+etag(current)))
+			return
+		}
+		patched, err := applyPatch(current, contentType, patch)
+		if err != nil {
+			api.writeError(writer, req, err)
+			return
+		}
+		if err := patched.Validate(); err != nil {
+			api.writeError(writer, req, err)
+			return
+		}
+
+		a, err = api.store.Automobiles().PatchByMark(req.Context(), mark, store.NewAutomobilePatch(current, patched), current.Version)
+		if errors.Is(err, store.ErrVersionMismatch) && req.Header.Get("If-Match") == "" && attempt < patchAttempts {
+			continue
+		}
+		if err != nil {
+			api.writeError(writer, req, err)
+			return
+		}
+		break
+	}
+	if a.Mark != mark {
+		writer.Header().Set("Location", prefix+"/auto/"+a.Mark)
+	}
+	writer.Header().Set("ETag", etag(a))
+	writeJSON(writer, http.StatusOK, a)
+}
+
+// applyPatch returns current with the patch applied, the id can not be changed
+func applyPatch(current *models.Automobiles, contentType string, patch []byte) (*models.Automobiles, error) {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == contentTypeJSONPatch {
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, errInvalidPatch.WithDetail(jsonErrorDetail(err))
+		}
+		if doc, err = ops.Apply(doc); err != nil {
+			return nil, errPatchFailed.WithDetail(err.Error())
+		}
+	} else {
+		if doc, err = jsonpatch.MergePatch(doc, patch); err != nil {
+			return nil, errInvalidPatch.WithDetail(jsonErrorDetail(err))
+		}
+	}
+
+	patched := &models.Automobiles{}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(patched); err != nil {
+		return nil, errPatchFailed.WithDetail(jsonErrorDetail(err))
+	}
+	if patched.ID != current.ID {
+		return nil, errPatchFailed.WithDetail("id can not be changed")
+	}
+	if patched.Version != current.Version {
+		return nil, errPatchFailed.WithDetail("version can not be changed, use If-Match")
+	}
+	return patched, nil
+}
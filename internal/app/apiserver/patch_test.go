@@ -0,0 +1,83 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+func TestPatchAuto(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		// location and maxspeed are checked on success
+		location string
+		maxspeed int
+	}{
+		{"merge patch", "application/merge-patch+json", `{"max_speed": 260}`, http.StatusOK, "", 260},
+		{"plain json is a merge patch", "application/json", `{"max_speed": 270}`, http.StatusOK, "", 270},
+		{"json patch", "application/json-patch+json", `[{"op": "replace", "path": "/max_speed", "value": 280}]`, http.StatusOK, "", 280},
+		{"rename", "application/merge-patch+json", `{"mark": "audi"}`, http.StatusOK, prefix + "/auto/audi", 250},
+		{"rename to taken mark", "application/merge-patch+json", `{"mark": "kia"}`, http.StatusConflict, "", 0},
+		{"unsupported type", "text/plain", `max_speed=260`, http.StatusUnsupportedMediaType, "", 0},
+		{"broken patch", "application/json-patch+json", `{"op": "replace"}`, http.StatusBadRequest, "", 0},
+		{"failed test op", "application/json-patch+json", `[{"op": "test", "path": "/max_speed", "value": 1}]`, http.StatusUnprocessableEntity, "", 0},
+		{"id can not change", "application/merge-patch+json", `{"id": 99}`, http.StatusUnprocessableEntity, "", 0},
+		{"unknown field", "application/merge-patch+json", `{"color": "red"}`, http.StatusUnprocessableEntity, "", 0},
+		{"invalid result", "application/merge-patch+json", `{"max_speed": -1}`, http.StatusUnprocessableEntity, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			editor := tokenFor(t, s, "editor", models.RoleEditor)
+			for _, mark := range []string{"bmw", "kia"} {
+				if rec := do(s, "POST", prefix+"/auto/"+mark, `{"max_speed": 250, "distance": 10, "handler": "ivan", "stock": "north"}`, bearer(editor), "192.0.2.1:1234"); rec.Code != http.StatusCreated {
+					t.Fatalf("create %s: got %d: %s", mark, rec.Code, rec.Body)
+				}
+			}
+
+			header := bearer(editor)
+			header.Set("Content-Type", tt.contentType)
+			rec := do(s, "PATCH", prefix+"/auto/bmw", tt.body, header, "192.0.2.1:1234")
+			if rec.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			if location := rec.Header().Get("Location"); location != tt.location {
+				t.Fatalf("got location %q, want %q", location, tt.location)
+			}
+			var a models.Automobiles
+			if err := json.NewDecoder(rec.Body).Decode(&a); err != nil {
+				t.Fatal(err)
+			}
+			if a.Maxspeed != tt.maxspeed || a.Distance != 10 || a.Handler != "ivan" {
+				t.Fatalf("got %+v", a)
+			}
+		})
+	}
+}
+
+func TestPutAutoRenames(t *testing.T) {
+	s := newTestServer(t, nil)
+	editor := tokenFor(t, s, "editor", models.RoleEditor)
+	body := `{"max_speed": 250, "distance": 10, "handler": "ivan", "stock": "north"}`
+	do(s, "POST", prefix+"/auto/bmw", body, bearer(editor), "192.0.2.1:1234")
+	do(s, "POST", prefix+"/auto/kia", body, bearer(editor), "192.0.2.1:1234")
+
+	rec := do(s, "PUT", prefix+"/auto/bmw", `{"mark": "audi", "max_speed": 240}`, bearer(editor), "192.0.2.1:1234")
+	if rec.Code != http.StatusAccepted || rec.Header().Get("Location") != prefix+"/auto/audi" {
+		t.Fatalf("got %d, location %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	if rec := do(s, "GET", prefix+"/auto/bmw", "", bearer(editor), "192.0.2.1:1234"); rec.Code != http.StatusNotFound {
+		t.Fatalf("old mark: got %d", rec.Code)
+	}
+	if rec := do(s, "PUT", prefix+"/auto/audi", `{"mark": "kia"}`, bearer(editor), "192.0.2.1:1234"); rec.Code != http.StatusConflict {
+		t.Fatalf("rename to taken mark: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/store"
+)
+
+// maxPageLimit caps the page size a client can ask for on GET /stock and GET /admin/login-attempts
+const maxPageLimit = 1000
+
+// defaultLoginAttemptsLimit is the page size of GET /admin/login-attempts without limit
+const defaultLoginAttemptsLimit = 100
+
+// parseAutomobilesQuery reads GET /stock query parameters:
+//
+//	limit, offset, cursor                  - paging (cursor comes from X-Next-Cursor)
+//	mark_prefix, handler, stock            - filters
+//	max_speed_min, max_speed_max           - max_speed range, inclusive
+//	distance_min, distance_max             - distance range, inclusive
+//	sort                                   - column to sort by, "-" in front for descending
+func parseAutomobilesQuery(values url.Values) (*store.AutomobilesQuery, error) {
+	q := &store.AutomobilesQuery{
+		Cursor:     values.Get("cursor"),
+		MarkPrefix: values.Get("mark_prefix"),
+		Handler:    values.Get("handler"),
+		Stock:      values.Get("stock"),
+	}
+	var err error
+	if q.Limit, err = intParam(values, "limit"); err != nil {
+		return nil, err
+	}
+	if q.Limit > maxPageLimit {
+		return nil, fmt.Errorf("limit must not be greater than %d", maxPageLimit)
+	}
+	if q.Offset, err = intParam(values, "offset"); err != nil {
+		return nil, err
+	}
+	ranges := map[string]**int{
+		"max_speed_min": &q.MinMaxspeed,
+		"max_speed_max": &q.MaxMaxspeed,
+		"distance_min":  &q.MinDistance,
+		"distance_max":  &q.MaxDistance,
+	}
+	for name, bound := range ranges {
+		if values.Get(name) == "" {
+			continue
+		}
+		v, err := intParam(values, name)
+		if err != nil {
+			return nil, err
+		}
+		*bound = &v
+	}
+	if sort := values.Get("sort"); sort != "" {
+		q.SortDesc = strings.HasPrefix(sort, "-")
+		q.SortBy = strings.TrimPrefix(sort, "-")
+	}
+	return q, nil
+}
+
+// parseLoginAttemptsQuery reads GET /admin/login-attempts query parameters:
+//
+//	limit, offset                          - paging, limit defaults to 100
+//	username, ip, outcome                  - filters
+//	since, until                           - created_at range in RFC 3339, inclusive
+func parseLoginAttemptsQuery(values url.Values) (*store.LoginAttemptsQuery, error) {
+	q := &store.LoginAttemptsQuery{
+		Username: values.Get("username"),
+		IP:       values.Get("ip"),
+		Outcome:  values.Get("outcome"),
+	}
+	if q.Outcome != "" && !models.ValidLoginOutcome(q.Outcome) {
+		return nil, fmt.Errorf("outcome %q is unknown", q.Outcome)
+	}
+	var err error
+	if q.Limit, err = intParam(values, "limit"); err != nil {
+		return nil, err
+	}
+	if q.Limit < 0 || q.Limit > maxPageLimit {
+		return nil, fmt.Errorf("limit must be between 0 and %d", maxPageLimit)
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultLoginAttemptsLimit
+	}
+	if q.Offset, err = intParam(values, "offset"); err != nil {
+		return nil, err
+	}
+	if q.Offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+	if q.Since, err = timeParam(values, "since"); err != nil {
+		return nil, err
+	}
+	if q.Until, err = timeParam(values, "until"); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func timeParam(values url.Values, name string) (time.Time, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	v, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a time in RFC 3339, e.g. 2006-01-02T15:04:05Z", name)
+	}
+	return v, nil
+}
+
+func intParam(values url.Values, name string) (int, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	return v, nil
+}
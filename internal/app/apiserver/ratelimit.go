@@ -0,0 +1,28 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/internal/app/ratelimit"
+)
+
+// configureRateLimit limits requests per route in process memory. Refused requests are counted
+// in the metrics, not audited: a flood of them must not turn into a flood of writes
+func (s *APIServer) configureRateLimit() {
+	s.limiter = ratelimit.New(s.config().RateLimit, ratelimit.NewMemoryStore(), s.rateLimitKey)
+	s.limiter.OnLimited(func(req *http.Request) {
+		s.metrics.RateLimited(middleware.RouteTemplate(req))
+	})
+}
+
+// rateLimitKey counts requests to anonymous routes per client IP, whatever token they carry.
+// Requests to other routes are counted per user if the token is valid, else per client IP
+func (s *APIServer) rateLimitKey(req *http.Request) string {
+	if !s.anonymousRoutes[middleware.RouteTemplate(req)] {
+		if name := s.jwt.Subject(req); name != "" {
+			return "user:" + name
+		}
+	}
+	return "ip:" + ratelimit.ClientIP(req, s.limiter.TrustProxy())
+}
@@ -0,0 +1,48 @@
+package apiserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/internal/app/ratelimit"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.RateLimit.Routes = []ratelimit.Rule{
+			{Route: prefix + "/auth", Requests: 1, Per: time.Hour},
+			{Route: prefix + "/stock", Requests: 1, Per: time.Hour},
+		}
+	})
+	alice := bearer(tokenFor(t, s, "alice", models.RoleViewer))
+	bob := bearer(tokenFor(t, s, "bob", models.RoleViewer))
+	login := `{"username":"nobody","password":"password1"}`
+
+	//The steps share the buckets and run in order
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		ip     string
+		want   int
+	}{
+		{"anonymous route, first from ip", "POST", prefix + "/auth", nil, "10.0.0.1", http.StatusUnauthorized},
+		{"anonymous route, ip bucket empty", "POST", prefix + "/auth", nil, "10.0.0.1", http.StatusTooManyRequests},
+		{"anonymous route, token does not buy a bucket", "POST", prefix + "/auth", alice, "10.0.0.1", http.StatusTooManyRequests},
+		{"anonymous route, other ip", "POST", prefix + "/auth", alice, "10.0.0.2", http.StatusUnauthorized},
+		{"authorized route, first of alice", "GET", prefix + "/stock", alice, "10.0.0.1", http.StatusOK},
+		{"authorized route, alice bucket empty", "GET", prefix + "/stock", alice, "10.0.0.3", http.StatusTooManyRequests},
+		{"authorized route, bob from same ip", "GET", prefix + "/stock", bob, "10.0.0.1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(s, tt.method, tt.path, login, tt.header, tt.ip+":1234")
+			if rec.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
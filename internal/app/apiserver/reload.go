@@ -0,0 +1,189 @@
+package apiserver
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/config"
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// Reloader reads the configuration again, from the same layers as on start
+type Reloader func() (*Config, error)
+
+// liveSettings are the config keys applied without restart, by key or key prefix.
+// Each applies the setting of c to the server and copies it to next, the config swapped in after reload
+var liveSettings = map[string]func(s *APIServer, next *Config, c *Config) error{
+	"log_level": func(s *APIServer, next *Config, c *Config) error {
+		level, err := logrus.ParseLevel(c.LogLevel)
+		if err != nil {
+			return err
+		}
+		s.logger.SetLevel(level)
+		next.LogLevel = c.LogLevel
+		return nil
+	},
+	"cors_origins": func(s *APIServer, next *Config, c *Config) error {
+		s.cors.SetOrigins(c.CORSOrigins)
+		next.CORSOrigins = c.CORSOrigins
+		return nil
+	},
+	"log_format": func(s *APIServer, next *Config, c *Config) error {
+		s.setLogFormat(c.LogFormat)
+		next.LogFormat = c.LogFormat
+		return nil
+	},
+	"log_file": func(s *APIServer, next *Config, c *Config) error {
+		if err := s.setLogFile(c.LogFile); err != nil {
+			return err
+		}
+		next.LogFile = c.LogFile
+		return nil
+	},
+	"jwt.": func(s *APIServer, next *Config, c *Config) error {
+		keys, err := middleware.NewKeySet(c.JWT)
+		if err != nil {
+			return err
+		}
+		s.jwt.SetKeys(keys)
+		next.JWT = c.JWT
+		return nil
+	},
+	"rate_limit.": func(s *APIServer, next *Config, c *Config) error {
+		s.limiter.SetConfig(c.RateLimit)
+		next.RateLimit = c.RateLimit
+		return nil
+	},
+	"store.max_open_conns":     setPool,
+	"store.max_idle_conns":     setPool,
+	"store.conn_max_lifetime":  setPool,
+	"store.conn_max_idle_time": setPool,
+}
+
+func setPool(s *APIServer, next *Config, c *Config) error {
+	s.store.SetPool(c.Store)
+	next.Store.MaxOpenConns = c.Store.MaxOpenConns
+	next.Store.MaxIdleConns = c.Store.MaxIdleConns
+	next.Store.ConnMaxLifetime = c.Store.ConnMaxLifetime
+	next.Store.ConnMaxIdleTime = c.Store.ConnMaxIdleTime
+	return nil
+}
+
+// EnableReload makes the server reload its config with reload on SIGHUP and,
+// if reload_interval is set, whenever the modification time of path changes
+func (s *APIServer) EnableReload(path string, reload Reloader) {
+	s.configPath = path
+	s.reloader = reload
+}
+
+// notifyReload starts catching SIGHUP, a signal sent before serving is handled once watchReload runs
+func (s *APIServer) notifyReload() {
+	if s.reloader == nil {
+		return
+	}
+	s.hup = make(chan os.Signal, 1)
+	signal.Notify(s.hup, syscall.SIGHUP)
+}
+
+func (s *APIServer) stopReload() {
+	if s.hup != nil {
+		signal.Stop(s.hup)
+	}
+}
+
+// watchReload waits for SIGHUP or config file changes until ctx is done
+func (s *APIServer) watchReload(ctx context.Context) {
+	if s.reloader == nil {
+		return
+	}
+
+	var tick <-chan time.Time
+	lastMod := s.configModTime()
+	if s.configPath != "" && s.config().ReloadInterval > 0 {
+		ticker := time.NewTicker(s.config().ReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.hup:
+			s.logger.Info("SIGHUP received, reloading config")
+			s.reload()
+		case <-tick:
+			if mod := s.configModTime(); !mod.Equal(lastMod) {
+				lastMod = mod
+				s.logger.Info("config file ", s.configPath, " changed, reloading config")
+				s.reload()
+			}
+		}
+	}
+}
+
+func (s *APIServer) configModTime() time.Time {
+	if s.configPath == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(s.configPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reload applies the settings that are safe to change live and logs the ones that need a restart.
+// An invalid config is rejected as a whole and the server keeps running with the old one.
+func (s *APIServer) reload() {
+	c, err := s.reloader()
+	if err == nil {
+		err = c.Validate()
+	}
+	if err != nil {
+		s.logger.Error("config reload rejected: ", err)
+		return
+	}
+
+	//The running config is copied, changed and swapped in, handlers never see it half applied
+	current := s.config()
+	next := *current
+	storeConfig := *current.Store
+	next.Store = &storeConfig
+
+	applied := make(map[string]bool)
+	var needRestart []string
+	for _, key := range config.Diff(current, c) {
+		prefix, apply := liveSetting(key)
+		if apply == nil {
+			needRestart = append(needRestart, key)
+			continue
+		}
+		if applied[prefix] {
+			continue
+		}
+		applied[prefix] = true
+		if err := apply(s, &next, c); err != nil {
+			s.logger.Error("can not apply ", key, ": ", err)
+			continue
+		}
+		s.logger.Info("config reloaded: ", strings.TrimSuffix(prefix, "."), " applied")
+	}
+	s.cfg.Store(&next)
+	if len(needRestart) > 0 {
+		s.logger.Warn("config reloaded: restart required to apply ", strings.Join(needRestart, ", "))
+	}
+}
+
+func liveSetting(key string) (string, func(s *APIServer, next *Config, c *Config) error) {
+	for prefix, apply := range liveSettings {
+		if key == prefix || (strings.HasSuffix(prefix, ".") && strings.HasPrefix(key, prefix)) {
+			return prefix, apply
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,61 @@
+package apiserver
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReloadAppliesLiveSettings(t *testing.T) {
+	s := newTestServer(t, nil)
+	before := s.config()
+	next := NewConfig()
+	*next = *before
+	storeConfig := *before.Store
+	next.Store = &storeConfig
+	next.LogLevel = "warn"
+	next.CORSOrigins = []string{"https://app.example.com"}
+	next.BindAddr = ":18081"
+	s.EnableReload("", func() (*Config, error) { return next, nil })
+
+	allowedOrigin := func() string {
+		header := http.Header{"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {"POST"}}
+		return do(s, "OPTIONS", prefix+"/auth", "", header, "192.0.2.1:1234").Header().Get("Access-Control-Allow-Origin")
+	}
+	if allowedOrigin() != "" {
+		t.Fatal("origin is allowed before reload")
+	}
+
+	s.reload()
+	if s.logger.GetLevel() != logrus.WarnLevel || s.config().LogLevel != "warn" {
+		t.Fatalf("log level is %s after reload", s.logger.GetLevel())
+	}
+	if allowedOrigin() != "https://app.example.com" {
+		t.Fatal("origin is not allowed after reload")
+	}
+	//bind_addr needs a restart and is left as it was
+	if s.config().BindAddr != before.BindAddr {
+		t.Fatalf("bind_addr changed live to %s", s.config().BindAddr)
+	}
+	if before.LogLevel == "warn" || len(before.CORSOrigins) != 0 {
+		t.Fatal("config of the previous generation was changed in place")
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	s := newTestServer(t, nil)
+	next := NewConfig()
+	*next = *s.config()
+	next.LogLevel = "verbose"
+	next.JWT = &middleware.JWTConfig{}
+	s.EnableReload("", func() (*Config, error) { return next, nil })
+	s.logger.SetOutput(io.Discard)
+
+	s.reload()
+	if s.config().LogLevel == "verbose" || len(s.config().JWT.Keys) == 0 {
+		t.Fatal("invalid config was applied")
+	}
+}
@@ -0,0 +1,110 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+func TestRolesPerRoute(t *testing.T) {
+	s := newTestServer(t, nil)
+	viewer := tokenFor(t, s, "viewer", models.RoleViewer)
+	editor := tokenFor(t, s, "editor", models.RoleEditor)
+	admin := tokenFor(t, s, "admin", models.RoleAdmin)
+	body := `{"max_speed": 250, "distance": 10, "handler": "ivan", "stock": "north"}`
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"viewer reads", viewer, "GET", prefix + "/stock", "", http.StatusOK},
+		{"viewer can not create", viewer, "POST", prefix + "/auto/bmw", body, http.StatusForbidden},
+		{"editor creates", editor, "POST", prefix + "/auto/bmw", body, http.StatusCreated},
+		{"editor can not delete", editor, "DELETE", prefix + "/auto/bmw", "", http.StatusForbidden},
+		{"editor can not grant roles", editor, "PUT", prefix + "/admin/users/viewer/role", `{"role": "admin"}`, http.StatusForbidden},
+		{"admin deletes", admin, "DELETE", prefix + "/auto/bmw", "", http.StatusAccepted},
+		{"admin grants unknown role", admin, "PUT", prefix + "/admin/users/viewer/role", `{"role": "root"}`, http.StatusBadRequest},
+		{"admin grants role of missing user", admin, "PUT", prefix + "/admin/users/nobody/role", `{"role": "editor"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := do(s, tt.method, tt.path, tt.body, bearer(tt.token), "192.0.2.1:1234").Code; code != tt.want {
+				t.Fatalf("got %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDemotionAppliesToIssuedTokens(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := tokenFor(t, s, "admin", models.RoleAdmin)
+	editor := tokenFor(t, s, "editor", models.RoleEditor)
+	body := `{"max_speed": 250}`
+
+	if code := do(s, "POST", prefix+"/auto/bmw", body, bearer(editor), "192.0.2.1:1234").Code; code != http.StatusCreated {
+		t.Fatalf("editor before demotion: got %d", code)
+	}
+	if code := do(s, "DELETE", prefix+"/admin/users/editor/role", "", bearer(admin), "192.0.2.1:1234").Code; code != http.StatusOK {
+		t.Fatalf("demotion: got %d", code)
+	}
+	if code := do(s, "POST", prefix+"/auto/audi", body, bearer(editor), "192.0.2.1:1234").Code; code != http.StatusForbidden {
+		t.Fatalf("token issued before demotion: got %d, want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	configured := func(c *Config) {
+		c.AdminUsername = "root"
+		c.AdminPassword = "password1"
+	}
+	role := func(s *APIServer, username string) string {
+		u, err := s.store.Usersauto().FindByUsername(context.Background(), username)
+		if err != nil {
+			return ""
+		}
+		return u.Role
+	}
+
+	t.Run("creates the missing admin", func(t *testing.T) {
+		s := newTestServer(t, configured)
+		if err := s.bootstrapAdmin(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := role(s, "root"); got != models.RoleAdmin {
+			t.Fatalf("root has role %q", got)
+		}
+	})
+	t.Run("promotes the existing user", func(t *testing.T) {
+		s := newTestServer(t, configured)
+		tokenFor(t, s, "root", models.RoleViewer)
+		if err := s.bootstrapAdmin(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := role(s, "root"); got != models.RoleAdmin {
+			t.Fatalf("root has role %q", got)
+		}
+	})
+	t.Run("leaves a demoted user alone once an admin exists", func(t *testing.T) {
+		s := newTestServer(t, configured)
+		tokenFor(t, s, "root", models.RoleViewer)
+		tokenFor(t, s, "alice", models.RoleAdmin)
+		if err := s.bootstrapAdmin(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := role(s, "root"); got != models.RoleViewer {
+			t.Fatalf("root has role %q", got)
+		}
+	})
+	t.Run("needs a password to create", func(t *testing.T) {
+		s := newTestServer(t, func(c *Config) { c.AdminUsername = "root" })
+		if err := s.bootstrapAdmin(context.Background()); err == nil {
+			t.Fatal("admin created without a password")
+		}
+	})
+}
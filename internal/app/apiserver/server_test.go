@@ -0,0 +1,77 @@
+package apiserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/store"
+)
+
+// newTestServer is an api server on the memory store, configured like Start does it
+// without tracing, metrics and listening. change adjusts the default config first
+func newTestServer(t *testing.T, change func(c *Config)) *APIServer {
+	t.Helper()
+	c := NewConfig()
+	c.Store.Driver = store.DriverMemory
+	c.JWT.SigningKeyID = "test"
+	c.JWT.Keys = []*middleware.JWTKey{{ID: "test", Algorithm: "HS256", Secret: "test secret of the api server"}}
+	if change != nil {
+		change(c)
+	}
+	s := New(c)
+	s.logger.SetOutput(io.Discard)
+	s.accessLogger.SetOutput(io.Discard)
+	if err := s.configureStore(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.store.Close)
+	if err := s.configureJWT(); err != nil {
+		t.Fatal(err)
+	}
+	s.configureRateLimit()
+	s.configureRouter()
+	return s
+}
+
+// tokensFor creates the user with the role and returns a token pair of it
+func tokensFor(t *testing.T, s *APIServer, username string, role string) *TokenMessage {
+	t.Helper()
+	u := &models.Usersauto{Username: username, Password: "password1", Role: role}
+	if _, err := s.store.Usersauto().Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := s.issueTokens(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+// tokenFor creates the user with the role and returns an access token of it
+func tokenFor(t *testing.T, s *APIServer, username string, role string) string {
+	t.Helper()
+	return tokensFor(t, s, username, role).AccessToken
+}
+
+// do sends a request to the router of s, remoteAddr is the client
+func do(s *APIServer, method string, path string, body string, header http.Header, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
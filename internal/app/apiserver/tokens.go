@@ -0,0 +1,104 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/form3tech-oss/jwt-go"
+)
+
+const (
+	accessTokenTTL  = 2 * time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// TokenMessage is Message carrying a token pair.
+// Message keeps the access token, as clients read it from there before refresh tokens existed.
+type TokenMessage struct {
+	Message
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// RefreshRequest is the body of /auth/refresh and /auth/logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func randomToken(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashRefreshToken is what the store keeps instead of the token itself
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens signs an access token for the user and saves a new refresh token for it
+func (s *APIServer) issueTokens(ctx context.Context, user *models.Usersauto) (*TokenMessage, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{}                      // Дополнительные действия (в формате мапы) для шифрования
+	claims["exp"] = now.Add(accessTokenTTL).Unix() //Время жизни токена
+	claims["iat"] = now.Unix()
+	claims["jti"] = jti // По jti токен можно отозвать до истечения срока
+	claims["role"] = user.Role
+	claims["name"] = user.Username
+	accessToken, err := s.jwt.Keys().Sign(claims) // Подписываем текущим ключом из конфига, kid попадет в заголовок
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.store.RefreshTokens().Create(ctx, &models.RefreshToken{
+		TokenHash: hashRefreshToken(refreshToken),
+		Username:  user.Username,
+		ExpiresAt: now.Add(refreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenMessage{
+		Message: Message{
+			StatusCode: 201,
+			Message:    accessToken,
+			IsError:    false,
+		},
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenTTL / time.Second),
+	}, nil
+}
+
+// revokeAccessToken puts the token with these claims on the denylist until it expires
+func (s *APIServer) revokeAccessToken(ctx context.Context, claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil
+	}
+	expiresAt := time.Now().Add(accessTokenTTL)
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+	return s.store.RevokedTokens().Revoke(ctx, jti, expiresAt)
+}
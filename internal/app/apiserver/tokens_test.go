@@ -0,0 +1,77 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+func refresh(t *testing.T, s *APIServer, refreshToken string) (int, *TokenMessage) {
+	t.Helper()
+	body, _ := json.Marshal(RefreshRequest{RefreshToken: refreshToken})
+	rec := do(s, "POST", prefix+"/auth/refresh", string(body), nil, "192.0.2.1:1234")
+	tokens := &TokenMessage{}
+	if rec.Code == http.StatusCreated {
+		if err := json.NewDecoder(rec.Body).Decode(tokens); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, tokens
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t, nil)
+	first := tokensFor(t, s, "alice", models.RoleViewer)
+
+	code, second := refresh(t, s, first.RefreshToken)
+	if code != http.StatusCreated || second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Fatalf("refresh: got %d, %+v", code, second)
+	}
+	if code := do(s, "GET", prefix+"/stock", "", bearer(second.AccessToken), "192.0.2.1:1234").Code; code == http.StatusUnauthorized {
+		t.Fatal("refreshed access token is rejected")
+	}
+	if code, _ := refresh(t, s, "unknown"); code != http.StatusUnauthorized {
+		t.Fatalf("unknown refresh token: got %d", code)
+	}
+}
+
+func TestRefreshTokenReuseRevokesAll(t *testing.T) {
+	s := newTestServer(t, nil)
+	stolen := tokensFor(t, s, "alice", models.RoleViewer)
+	//Another session of the same user
+	other, err := s.issueTokens(context.Background(), &models.Usersauto{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, rotated := refresh(t, s, stolen.RefreshToken)
+	if code != http.StatusCreated {
+		t.Fatalf("refresh: got %d", code)
+	}
+	if code, _ := refresh(t, s, stolen.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: got %d", code)
+	}
+	for name, token := range map[string]string{"rotated": rotated.RefreshToken, "other session": other.RefreshToken} {
+		if code, _ := refresh(t, s, token); code != http.StatusUnauthorized {
+			t.Fatalf("%s refresh token outlived the reuse: got %d", name, code)
+		}
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	s := newTestServer(t, nil)
+	tokens := tokensFor(t, s, "alice", models.RoleViewer)
+
+	if code := do(s, "POST", prefix+"/auth/logout", "", bearer(tokens.AccessToken), "192.0.2.1:1234").Code; code != http.StatusOK {
+		t.Fatalf("logout: got %d", code)
+	}
+	if code := do(s, "GET", prefix+"/stock", "", bearer(tokens.AccessToken), "192.0.2.1:1234").Code; code != http.StatusUnauthorized {
+		t.Fatalf("access token after logout: got %d", code)
+	}
+	if code, _ := refresh(t, s, tokens.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("refresh token after logout: got %d", code)
+	}
+}
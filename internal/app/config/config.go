@@ -0,0 +1,222 @@
+// Package config resolves the apiserver configuration from several layers,
+// each one overriding the previous:
+//
+//	defaults (apiserver.NewConfig) < config file < APISERVER_* env vars < command-line flags
+//
+// The file may be TOML, YAML, JSON or .env. Keys are the toml names of the config fields,
+// nested with dots in files and flags (store.database_url) and with underscores
+// in env vars and .env files (APISERVER_STORE_DATABASE_URL). Unknown keys are an error.
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported file formats
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatEnv  = "env"
+)
+
+// Sources maps every config key to where its value came from,
+// e.g. "default", "file configs/apiserver.toml", "env APISERVER_LOG_LEVEL", "flag -log_level"
+type Sources map[string]string
+
+// Loader merges the configuration layers into a config struct
+type Loader struct {
+	// Path of the config file, no file is read when empty
+	Path string
+	// Format overrides the format guessed from the extension of Path
+	Format string
+	// EnvPrefix selects env vars, e.g. "APISERVER_"
+	EnvPrefix string
+	// Environ is the environment in os.Environ form
+	Environ []string
+	// Flags must be parsed already. Only flags registered by RegisterFlags are used
+	Flags *flag.FlagSet
+}
+
+// UnknownKeysError lists every key of the file, env or flags that matches no config field
+type UnknownKeysError struct {
+	Keys []string
+}
+
+func (e *UnknownKeysError) Error() string {
+	return "unknown config keys: " + strings.Join(e.Keys, ", ")
+}
+
+// RegisterFlags defines one string flag per config key, named like the key: -log_level, -store.database_url
+func RegisterFlags(fs *flag.FlagSet, cfg interface{}) {
+	for _, f := range fields(reflect.TypeOf(cfg)) {
+		fs.String(f.Key, "", "overrides config key "+f.Key)
+	}
+}
+
+// Load fills cfg, which must already hold the defaults, and reports the source of every key
+func (l *Loader) Load(cfg interface{}) (Sources, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || !isStruct(v.Type()) {
+		return nil, fmt.Errorf("config: %T is not a pointer to struct", cfg)
+	}
+	all := fields(v.Type())
+	byKey := make(map[string]field, len(all))
+	sources := make(Sources, len(all))
+	for _, f := range all {
+		byKey[f.Key] = f
+		sources[f.Key] = "default"
+	}
+	var unknown []string
+
+	//env vars: APISERVER_STORE_DATABASE_URL -> store.database_url
+	byEnv := make(map[string]field, len(all))
+	for _, f := range all {
+		byEnv[envName(f.Key)] = f
+	}
+
+	if l.Path != "" {
+		source := "file " + l.Path
+		raw, err := ioutil.ReadFile(l.Path)
+		if err != nil {
+			return nil, err
+		}
+		if l.format() == FormatEnv {
+			//.env keys are matched like env vars, with or without the prefix and in any case:
+			//log_level, LOG_LEVEL, APISERVER_LOG_LEVEL
+			vars, err := godotenv.Unmarshal(string(raw))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", l.Path, err)
+			}
+			for name, value := range vars {
+				f, ok := byEnv[strings.TrimPrefix(strings.ToUpper(name), l.EnvPrefix)]
+				if !ok {
+					unknown = append(unknown, name+" ("+source+")")
+					continue
+				}
+				if err := assignString(fieldValue(v, f.Index), value, name, &unknown); err != nil {
+					return nil, fmt.Errorf("%s: %w", l.Path, err)
+				}
+				sources[f.Key] = source
+			}
+		} else {
+			doc, err := l.readFile(raw)
+			if err != nil {
+				return nil, err
+			}
+			var fileUnknown []string
+			set := func(key string) { sources[key] = source }
+			if err := applyMap(v, doc, "", &fileUnknown, set); err != nil {
+				return nil, fmt.Errorf("%s: %w", l.Path, err)
+			}
+			for _, key := range fileUnknown {
+				unknown = append(unknown, key+" ("+source+")")
+			}
+		}
+	}
+	for _, kv := range l.Environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || l.EnvPrefix == "" || !strings.HasPrefix(parts[0], l.EnvPrefix) {
+			continue
+		}
+		f, ok := byEnv[strings.TrimPrefix(parts[0], l.EnvPrefix)]
+		if !ok {
+			unknown = append(unknown, parts[0]+" (env)")
+			continue
+		}
+		if err := assignString(fieldValue(v, f.Index), parts[1], parts[0], &unknown); err != nil {
+			return nil, err
+		}
+		sources[f.Key] = "env " + parts[0]
+	}
+
+	if l.Flags != nil {
+		var err error
+		l.Flags.Visit(func(fl *flag.Flag) {
+			f, ok := byKey[fl.Name]
+			if !ok || err != nil {
+				return
+			}
+			if err = assignString(fieldValue(v, f.Index), fl.Value.String(), "-"+fl.Name, &unknown); err == nil {
+				sources[f.Key] = "flag -" + fl.Name
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, &UnknownKeysError{Keys: unknown}
+	}
+	return sources, nil
+}
+
+// envName is the env var name of a key without prefix
+func envName(key string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_").Replace(key))
+}
+
+func (l *Loader) format() string {
+	format := strings.TrimPrefix(strings.ToLower(l.Format), ".")
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(l.Path)), ".")
+	}
+	switch format {
+	case "yml":
+		return FormatYAML
+	case "":
+		//Files like ".env" have no extension, only a name
+		if strings.HasSuffix(l.Path, ".env") {
+			return FormatEnv
+		}
+	}
+	return format
+}
+
+// readFile decodes a toml, yaml or json config file into a generic document
+func (l *Loader) readFile(raw []byte) (map[string]interface{}, error) {
+	var err error
+	doc := make(map[string]interface{})
+	switch l.format() {
+	case FormatTOML:
+		err = toml.Unmarshal(raw, &doc)
+	case FormatYAML:
+		err = yaml.Unmarshal(raw, &doc)
+	case FormatJSON:
+		err = json.Unmarshal(raw, &doc)
+	default:
+		return nil, fmt.Errorf("%s: unknown config format %q, use toml, yaml, json or env", l.Path, l.format())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", l.Path, err)
+	}
+	return doc, nil
+}
+
+// Diff returns the keys whose values differ between two configs of the same type
+func Diff(old, new interface{}) []string {
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	if ov.Type() != nv.Type() {
+		return nil
+	}
+	var changed []string
+	for _, f := range fields(ov.Type()) {
+		if !reflect.DeepEqual(fieldValue(ov, f.Index).Interface(), fieldValue(nv, f.Index).Interface()) {
+			changed = append(changed, f.Key)
+		}
+	}
+	return changed
+}
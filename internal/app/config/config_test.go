@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testStore struct {
+	DatabaseURL string `toml:"database_url" secret:"true"`
+	MaxConns    int    `toml:"max_conns"`
+}
+
+type testKey struct {
+	ID     string `toml:"id"`
+	Secret string `toml:"secret" secret:"true"`
+}
+
+type testConfig struct {
+	LogLevel string        `toml:"log_level"`
+	Timeout  time.Duration `toml:"timeout"`
+	Enabled  bool          `toml:"enabled"`
+	Origins  []string      `toml:"origins"`
+	Store    *testStore    `toml:"store"`
+	Keys     []*testKey    `toml:"keys"`
+}
+
+func newTestConfig() *testConfig {
+	return &testConfig{LogLevel: "info", Timeout: time.Second, Store: &testStore{MaxConns: 5}}
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "apiserver.toml", `
+log_level = "debug"
+timeout = "15s"
+
+[store]
+database_url = "host=file"
+max_conns = 10
+`)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs, newTestConfig())
+	if err := fs.Parse([]string{"-store.max_conns", "20"}); err != nil {
+		t.Fatal(err)
+	}
+	l := &Loader{
+		Path:      path,
+		EnvPrefix: "APP_",
+		Environ:   []string{"APP_STORE_DATABASE_URL=host=env", "OTHER_LOG_LEVEL=trace", "APP_ORIGINS=a.com, b.com"},
+		Flags:     fs,
+	}
+	cfg := newTestConfig()
+	sources, err := l.Load(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &testConfig{
+		LogLevel: "debug",
+		Timeout:  15 * time.Second,
+		Origins:  []string{"a.com", "b.com"},
+		Store:    &testStore{DatabaseURL: "host=env", MaxConns: 20},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v %+v, want %+v %+v", cfg, cfg.Store, want, want.Store)
+	}
+	for key, source := range map[string]string{
+		"log_level":          "file " + path,
+		"enabled":            "default",
+		"store.database_url": "env APP_STORE_DATABASE_URL",
+		"store.max_conns":    "flag -store.max_conns",
+	} {
+		if sources[key] != source {
+			t.Errorf("source of %s is %q, want %q", key, sources[key], source)
+		}
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"toml", "c.toml", "log_level = \"warn\"\n[store]\nmax_conns = 7\n[[keys]]\nid = \"k1\"\n"},
+		{"yaml", "c.yml", "log_level: warn\nstore:\n  max_conns: 7\nkeys:\n  - id: k1\n"},
+		{"json", "c.json", `{"log_level": "warn", "store": {"max_conns": 7}, "keys": [{"id": "k1"}]}`},
+		{"env", ".env", "LOG_LEVEL=warn\nAPP_STORE_MAX_CONNS=7\nkeys='[{\"id\": \"k1\"}]'\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			l := &Loader{Path: writeFile(t, tt.file, tt.content), EnvPrefix: "APP_"}
+			if _, err := l.Load(cfg); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.LogLevel != "warn" || cfg.Store.MaxConns != 7 || len(cfg.Keys) != 1 || cfg.Keys[0].ID != "k1" {
+				t.Fatalf("got %+v %+v %v", cfg, cfg.Store, cfg.Keys)
+			}
+		})
+	}
+}
+
+func TestLoadUnknownKeys(t *testing.T) {
+	l := &Loader{
+		Path:      writeFile(t, "c.toml", "log_levle = \"debug\"\n[store]\ndatabase = \"x\"\n"),
+		EnvPrefix: "APP_",
+		Environ:   []string{"APP_TIMEOUTS=1s"},
+	}
+	_, err := l.Load(newTestConfig())
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("got %v, want UnknownKeysError", err)
+	}
+	want := []string{"APP_TIMEOUTS (env)", "log_levle (file " + l.Path + ")", "store.database (file " + l.Path + ")"}
+	if !reflect.DeepEqual(unknown.Keys, want) {
+		t.Fatalf("got %q, want %q", unknown.Keys, want)
+	}
+}
+
+func TestLoadInvalidValues(t *testing.T) {
+	for name, content := range map[string]string{
+		"duration as number": "timeout = 15",
+		"bad duration":       `timeout = "soon"`,
+		"string as table":    `store = "x"`,
+		"bad int":            "[store]\nmax_conns = \"many\"",
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := &Loader{Path: writeFile(t, "c.toml", content)}
+			if _, err := l.Load(newTestConfig()); err == nil {
+				t.Fatal("invalid value is accepted")
+			}
+		})
+	}
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Store.DatabaseURL = "password=hunter2"
+	cfg.Keys = []*testKey{{ID: "k1", Secret: "topsecret"}}
+	var out bytes.Buffer
+	if err := Print(&out, cfg, Sources{"log_level": "default"}); err != nil {
+		t.Fatal(err)
+	}
+	printed := out.String()
+	if strings.Contains(printed, "hunter2") || strings.Contains(printed, "topsecret") {
+		t.Fatalf("secret printed:\n%s", printed)
+	}
+	if !strings.Contains(printed, `log_level = "info"`) || !strings.Contains(printed, `"k1"`) {
+		t.Fatalf("values missing:\n%s", printed)
+	}
+}
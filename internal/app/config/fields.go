@@ -0,0 +1,224 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is one settable leaf of a config struct, e.g. "store.database_url"
+type field struct {
+	Key    string
+	Index  []int
+	Secret bool
+}
+
+// fieldName is the toml name of a struct field, its lowercased name without a tag
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("toml"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// fields lists the leaves of struct type t. Nested structs are flattened with dots,
+// everything else, slices of structs included, is a leaf.
+func fields(t reflect.Type) []field {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("toml") == "-" {
+			continue
+		}
+		if isStruct(f.Type) {
+			for _, nested := range fields(f.Type) {
+				nested.Key = fieldName(f) + "." + nested.Key
+				nested.Index = append([]int{i}, nested.Index...)
+				out = append(out, nested)
+			}
+			continue
+		}
+		out = append(out, field{
+			Key:    fieldName(f),
+			Index:  []int{i},
+			Secret: f.Tag.Get("secret") == "true",
+		})
+	}
+	return out
+}
+
+// fieldValue returns the leaf at index, allocating nil struct pointers on the way
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// applyMap sets the fields of struct v from a decoded document.
+// Keys that match no field are appended to unknown with their full path.
+func applyMap(v reflect.Value, m map[string]interface{}, path string, unknown *[]string, set func(key string)) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	byName := make(map[string]int)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath == "" && f.Tag.Get("toml") != "-" {
+			byName[fieldName(f)] = i
+		}
+	}
+	for name, raw := range m {
+		key := name
+		if path != "" {
+			key = path + "." + name
+		}
+		i, ok := byName[strings.ToLower(name)]
+		if !ok {
+			*unknown = append(*unknown, key)
+			continue
+		}
+		fv := v.Field(i)
+		if isStruct(fv.Type()) {
+			nested, ok := raw.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: must be a table", key)
+			}
+			if err := applyMap(fv, nested, key, unknown, set); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := assign(fv, raw, key, unknown); err != nil {
+			return err
+		}
+		if set != nil {
+			set(key)
+		}
+	}
+	return nil
+}
+
+// assign converts a decoded value into v. Strings are parsed, since env vars and flags are strings.
+func assign(v reflect.Value, raw interface{}, key string, unknown *[]string) error {
+	if s, ok := raw.(string); ok {
+		return assignString(v, s, key, unknown)
+	}
+	rv := reflect.ValueOf(raw)
+	switch {
+	case v.Type() == durationType:
+		return fmt.Errorf("%s: duration must be a string like \"15s\", got %v", key, raw)
+	case v.Kind() == reflect.Ptr && isStruct(v.Type()):
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be a table", key)
+		}
+		return applyMap(v, m, key, unknown, nil)
+	case v.Kind() == reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be a table", key)
+		}
+		return applyMap(v.Addr(), m, key, unknown, nil)
+	case v.Kind() == reflect.Slice:
+		if rv.Kind() != reflect.Slice {
+			return fmt.Errorf("%s: must be a list", key)
+		}
+		out := reflect.MakeSlice(v.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			if err := assign(out.Index(i), rv.Index(i).Interface(), fmt.Sprintf("%s[%d]", key, i), unknown); err != nil {
+				return err
+			}
+		}
+		v.Set(out)
+		return nil
+	case v.Kind() == reflect.Bool && rv.Kind() == reflect.Bool:
+		v.SetBool(rv.Bool())
+		return nil
+	}
+	//Numbers come as int64 from toml and yaml and as float64 from json
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return assignString(v, fmt.Sprint(raw), key, unknown)
+	}
+	return fmt.Errorf("%s: can not use %T as %s", key, raw, v.Type())
+}
+
+func assignString(v reflect.Value, s string, key string, unknown *[]string) error {
+	var err error
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		if d, err = time.ParseDuration(s); err == nil {
+			v.SetInt(int64(d))
+		}
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+		}
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, v.Type().Bits()); err == nil {
+			v.SetInt(n)
+		}
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, v.Type().Bits()); err == nil {
+			v.SetUint(n)
+		}
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		parts := strings.Split(s, ",")
+		out := reflect.MakeSlice(v.Type(), 0, len(parts))
+		for _, p := range parts {
+			if p = strings.TrimSpace(p); p != "" {
+				out = reflect.Append(out, reflect.ValueOf(p).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(out)
+	default:
+		//Lists of tables and tables are written as JSON in env vars and flags
+		var raw interface{}
+		if err := json.Unmarshal([]byte(s), &raw); err != nil {
+			return fmt.Errorf("%s: expected JSON for %s: %v", key, v.Type(), err)
+		}
+		return assign(v, raw, key, unknown)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid %s %q", key, v.Type(), s)
+	}
+	return nil
+}
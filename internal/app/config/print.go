@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+)
+
+// mask replaces the values of fields tagged secret:"true"
+const mask = "******"
+
+// Print writes every key of the resolved cfg with its value and source. Secrets are masked.
+func Print(w io.Writer, cfg interface{}, sources Sources) error {
+	v := reflect.ValueOf(cfg)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, f := range fields(v.Type()) {
+		value := render(fieldValue(v, f.Index), f.Secret)
+		fmt.Fprintf(tw, "%s = %s\t# %s\n", f.Key, value, sources[f.Key])
+	}
+	return tw.Flush()
+}
+
+func render(v reflect.Value, secret bool) string {
+	generic := toGeneric(v, secret)
+	if s, ok := generic.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	raw, err := json.Marshal(generic)
+	if err != nil {
+		return fmt.Sprint(generic)
+	}
+	return string(raw)
+}
+
+// toGeneric converts v to plain maps and slices named by toml keys, masking secrets on the way
+func toGeneric(v reflect.Value, secret bool) interface{} {
+	if secret {
+		if v.IsZero() {
+			return ""
+		}
+		return mask
+	}
+	switch {
+	case v.Type() == durationType:
+		return fmt.Sprint(v.Interface())
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return toGeneric(v.Elem(), false)
+	case v.Kind() == reflect.Struct:
+		m := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" || f.Tag.Get("toml") == "-" {
+				continue
+			}
+			m[fieldName(f)] = toGeneric(v.Field(i), f.Tag.Get("secret") == "true")
+		}
+		return m
+	case v.Kind() == reflect.Slice:
+		if v.IsNil() {
+			return []interface{}{}
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = toGeneric(v.Index(i), false)
+		}
+		return out
+	}
+	return v.Interface()
+}
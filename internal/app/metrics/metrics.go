@@ -0,0 +1,180 @@
+// Package metrics collects Prometheus metrics of the api server:
+// HTTP requests by mux route template, store queries by repository, the connection pool,
+// authentication outcomes and requests refused by the rate limiter. They are served on a separate admin address, see Config.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "apiserver"
+
+// Authentication outcomes counted by AuthOutcome, the JWT middleware reports its own failures
+const (
+	AuthIssued          = "issued"
+	AuthRefreshed       = "refreshed"
+	AuthRefreshRejected = "refresh_rejected"
+	AuthLoginFailed     = "login_failed"
+	AuthLoginLocked     = "login_locked"
+)
+
+// Config of the admin server
+type Config struct {
+	Enabled bool `toml:"enabled"`
+	// BindAddr of the admin server serving /metrics, must differ from the api bind_addr
+	BindAddr string `toml:"bind_addr"`
+}
+
+// NewConfig returns the default config, metrics are off
+func NewConfig() *Config {
+	return &Config{
+		BindAddr: ":9090",
+	}
+}
+
+// Metrics of one api server, registered in its own registry
+type Metrics struct {
+	registry      *prometheus.Registry
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	inFlight      *prometheus.GaugeVec
+	queryDuration *prometheus.HistogramVec
+	queryErrors   *prometheus.CounterVec
+	auth          *prometheus.CounterVec
+	rateLimited   *prometheus.CounterVec
+}
+
+// New registers the metrics together with the Go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route template, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests being served by route template and method.",
+		}, []string{"route", "method"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_query_duration_seconds",
+			Help:      "Duration of repository calls by repository and method.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"repository", "operation"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "store_query_errors_total",
+			Help:      "Failed repository calls by repository, method and error kind.",
+		}, []string{"repository", "operation", "kind"}),
+		auth: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_outcomes_total",
+			Help:      "Authentication outcomes: access tokens issued, refreshed, rejected, expired or revoked, rejected refresh tokens, failed and locked out logins.",
+		}, []string{"outcome"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Requests refused by the rate limiter by route template.",
+		}, []string{"route"}),
+	}
+	m.registry.MustRegister(
+		m.requests, m.duration, m.inFlight,
+		m.queryDuration, m.queryErrors, m.auth, m.rateLimited,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts and times the requests of a mux router, use it with Router.Use
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Templates keep the label set small: /api/v1/auto/{mark} instead of every mark
+		route := middleware.RouteTemplate(r)
+		inFlight := m.inFlight.WithLabelValues(route, r.Method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		sw := middleware.NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+		status := strconv.Itoa(sw.Status())
+		m.requests.WithLabelValues(route, r.Method, status).Inc()
+		m.duration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// QueryHook times repository calls, add it with store.AddQueryHook
+func (m *Metrics) QueryHook(ctx context.Context, repository string, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		m.queryDuration.WithLabelValues(repository, operation).Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.queryErrors.WithLabelValues(repository, operation, errorKind(err)).Inc()
+		}
+	}
+}
+
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, store.ErrConflict):
+		return "conflict"
+	case errors.Is(err, store.ErrVersionMismatch):
+		return "version_mismatch"
+	case errors.Is(err, store.ErrUnavailable), errors.Is(err, context.DeadlineExceeded):
+		return "unavailable"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return "other"
+}
+
+// RegisterDBStats reports the connection pool stats returned by stats, e.g. store.Stats
+func (m *Metrics) RegisterDBStats(stats func() sql.DBStats) {
+	m.registry.MustRegister(newDBStatsCollector(stats))
+}
+
+// AuthOutcome counts one authentication outcome. It does nothing on a nil Metrics,
+// so callers need not check whether metrics are enabled.
+func (m *Metrics) AuthOutcome(outcome string) {
+	if m == nil {
+		return
+	}
+	m.auth.WithLabelValues(outcome).Inc()
+}
+
+// RateLimited counts one request to route refused by the rate limiter. Like AuthOutcome
+// it does nothing on a nil Metrics.
+func (m *Metrics) RateLimited(route string) {
+	if m == nil {
+		return
+	}
+	m.rateLimited.WithLabelValues(route).Inc()
+}
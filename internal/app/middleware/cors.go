@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// corsMaxAge is how long browsers may cache a preflight answer
+const corsMaxAge = 10 * 60
+
+// CORS lets browsers on the allowed origins call the API.
+// The origins can be replaced while serving, e.g. on config reload.
+type CORS struct {
+	mu      sync.RWMutex
+	any     bool
+	origins map[string]bool
+}
+
+// NewCORS allows the given origins, "*" allows any. No origins means no CORS headers at all
+func NewCORS(origins []string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(origins)
+	return c
+}
+
+// SetOrigins replaces the allowed origins for requests from now on
+func (c *CORS) SetOrigins(origins []string) {
+	allowed := make(map[string]bool, len(origins))
+	any := false
+	for _, o := range origins {
+		if o == "*" {
+			any = true
+		}
+		allowed[strings.TrimSuffix(o, "/")] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.any, c.origins = any, allowed
+}
+
+func (c *CORS) allowed(origin string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.any || c.origins[origin]
+}
+
+// Handler adds CORS headers for allowed origins and answers preflight requests itself
+func (c *CORS) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !c.allowed(origin) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			w.Header().Set("Access-Control-Allow-Headers", requested)
+		}
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
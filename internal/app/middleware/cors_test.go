@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	c := NewCORS([]string{"https://app.example.com/"})
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	serve := func(method string, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/stock", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "authorization, idempotency-key")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		preflight  bool
+		wantCode   int
+		wantOrigin string
+	}{
+		{"same origin request", "GET", "", false, http.StatusTeapot, ""},
+		{"allowed origin", "GET", "https://app.example.com", false, http.StatusTeapot, "https://app.example.com"},
+		{"other origin", "GET", "https://evil.example.com", false, http.StatusTeapot, ""},
+		{"preflight of allowed origin", "OPTIONS", "https://app.example.com", true, http.StatusNoContent, "https://app.example.com"},
+		{"preflight of other origin", "OPTIONS", "https://evil.example.com", true, http.StatusTeapot, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.method, tt.origin, tt.preflight)
+			if rec.Code != tt.wantCode || rec.Header().Get("Access-Control-Allow-Origin") != tt.wantOrigin {
+				t.Fatalf("got %d with origin %q, want %d with %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"), tt.wantCode, tt.wantOrigin)
+			}
+			if tt.preflight && tt.wantCode == http.StatusNoContent && rec.Header().Get("Access-Control-Allow-Headers") != "authorization, idempotency-key" {
+				t.Fatalf("preflight allows headers %q", rec.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+
+	c.SetOrigins([]string{"*"})
+	if got := serve("GET", "https://evil.example.com", false).Header().Get("Access-Control-Allow-Origin"); got != "https://evil.example.com" {
+		t.Fatalf("* does not allow any origin after SetOrigins, got %q", got)
+	}
+	c.SetOrigins(nil)
+	if got := serve("GET", "https://app.example.com", false).Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("origin is allowed after SetOrigins(nil), got %q", got)
+	}
+}
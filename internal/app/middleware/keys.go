@@ -0,0 +1,283 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/form3tech-oss/jwt-go"
+)
+
+// JWTConfig lists the keys tokens are signed and verified with.
+// To rotate, add the new key, point SigningKeyID at it and drop the old key
+// once the tokens it signed have expired.
+type JWTConfig struct {
+	// SigningKeyID is the id of the key from Keys new tokens are signed with
+	SigningKeyID string    `toml:"signing_key_id"`
+	Keys         []*JWTKey `toml:"keys"`
+}
+
+// JWTKey is one signing or verification key
+type JWTKey struct {
+	// ID goes to the kid header of tokens signed with this key
+	ID string `toml:"id"`
+	// Algorithm is one of HS256, RS256, ES256, EdDSA
+	Algorithm string `toml:"algorithm"`
+	// Secret or SecretFile hold the shared secret of HS256 keys
+	Secret     string `toml:"secret" secret:"true"`
+	SecretFile string `toml:"secret_file"`
+	// PrivateKeyFile is a PEM private key of an asymmetric key
+	PrivateKeyFile string `toml:"private_key_file"`
+	// PublicKeyFile is a PEM public key, enough for keys that only verify
+	PublicKeyFile string `toml:"public_key_file"`
+}
+
+// NewJWTConfig returns config without keys
+func NewJWTConfig() *JWTConfig {
+	return &JWTConfig{}
+}
+
+// Key is a loaded JWTKey
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet signs new tokens with one key and verifies tokens with any of its keys
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []*Key
+}
+
+// NewKeySet loads every key of the config
+func NewKeySet(config *JWTConfig) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key)}
+	for _, c := range config.Keys {
+		if c.ID == "" {
+			return nil, errors.New("jwt key without id")
+		}
+		if _, ok := ks.keys[c.ID]; ok {
+			return nil, fmt.Errorf("duplicate jwt key id %q", c.ID)
+		}
+		k, err := loadKey(c)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", c.ID, err)
+		}
+		ks.keys[k.ID] = k
+		ks.order = append(ks.order, k)
+	}
+	signing, ok := ks.keys[config.SigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwt signing key %q is not configured", config.SigningKeyID)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("jwt signing key %q has no private key", signing.ID)
+	}
+	ks.signing = signing
+	return ks, nil
+}
+
+func loadKey(c *JWTKey) (*Key, error) {
+	method := jwt.GetSigningMethod(c.Algorithm)
+	k := &Key{ID: c.ID, Method: method}
+	switch method {
+	case jwt.SigningMethodHS256:
+		secret := []byte(c.Secret)
+		if c.SecretFile != "" {
+			raw, err := ioutil.ReadFile(c.SecretFile)
+			if err != nil {
+				return nil, err
+			}
+			secret = []byte(strings.TrimSpace(string(raw)))
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("empty secret")
+		}
+		k.signKey, k.verifyKey = secret, secret
+		return k, nil
+	case jwt.SigningMethodRS256, jwt.SigningMethodES256, SigningMethodEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", c.Algorithm)
+	}
+
+	if c.PrivateKeyFile != "" {
+		private, err := readPrivateKey(c.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		k.signKey = private
+		k.verifyKey = private.(crypto.Signer).Public()
+	}
+	if c.PublicKeyFile != "" {
+		public, err := readPublicKey(c.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		k.verifyKey = public
+	}
+	if k.verifyKey == nil {
+		return nil, errors.New("neither private_key_file nor public_key_file is set")
+	}
+	if err := checkKeyType(method, k.verifyKey); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func checkKeyType(method jwt.SigningMethod, key interface{}) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if method == jwt.SigningMethodRS256 {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if method == jwt.SigningMethodES256 && key.Curve == elliptic.P256() {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if method == SigningMethodEdDSA {
+			return nil
+		}
+	}
+	return fmt.Errorf("%T does not fit algorithm %s", key, method.Alg())
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported private key", path)
+}
+
+func readPublicKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported public key", path)
+}
+
+// Sign returns the signed token with the kid header of the signing key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Keyfunc picks the verification key by the kid header.
+// Tokens without kid were issued before rotation support and are checked against the signing key.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	k := ks.signing
+	if kid, ok := token.Header["kid"]; ok {
+		id, _ := kid.(string)
+		if k, ok = ks.keys[id]; !ok {
+			return nil, fmt.Errorf("unknown key id %q", id)
+		}
+	}
+	//Never let the token choose the algorithm, e.g. HS256 with a public RSA key as secret
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return k.verifyKey, nil
+}
+
+// JWK is a public key in RFC 7517 form
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public keys of the set. Shared HS256 secrets are never published.
+func (ks *KeySet) JWKS() *JWKS {
+	set := &JWKS{Keys: make([]JWK, 0, len(ks.order))}
+	for _, k := range ks.order {
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+		switch key := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeBigInt(key.N, 0)
+			jwk.E = encodeBigInt(big.NewInt(int64(key.E)), 0)
+		case *ecdsa.PublicKey:
+			size := (key.Curve.Params().BitSize + 7) / 8
+			jwk.Kty, jwk.Crv = "EC", key.Curve.Params().Name
+			jwk.X = encodeBigInt(key.X, size)
+			jwk.Y = encodeBigInt(key.Y, size)
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(key)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// encodeBigInt encodes n big-endian, left padded with zeros to size bytes
+func encodeBigInt(n *big.Int, size int) string {
+	raw := n.Bytes()
+	if len(raw) < size {
+		raw = append(make([]byte, size-len(raw)), raw...)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
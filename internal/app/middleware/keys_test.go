@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/form3tech-oss/jwt-go"
+)
+
+// writePrivateKey saves key as PKCS #8 PEM and returns the file name
+func writePrivateKey(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func verify(ks *KeySet, token string) error {
+	_, err := jwt.Parse(token, ks.Keyfunc)
+	return err
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := &JWTKey{ID: "old", Algorithm: "HS256", Secret: "old secret"}
+	newKey := &JWTKey{ID: "new", Algorithm: "HS256", Secret: "new secret"}
+
+	before, err := NewKeySet(&JWTConfig{SigningKeyID: "old", Keys: []*JWTKey{oldKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.Sign(jwt.MapClaims{"sub": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Token signed before kid support
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString([]byte("old secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	during, err := NewKeySet(&JWTConfig{SigningKeyID: "new", Keys: []*JWTKey{oldKey, newKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := during.Sign(jwt.MapClaims{"sub": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(during, oldToken); err != nil {
+		t.Fatalf("token of the old key is rejected during rotation: %v", err)
+	}
+	if err := verify(during, newToken); err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := jwt.Parse(newToken, during.Keyfunc)
+	if parsed.Header["kid"] != "new" {
+		t.Fatalf("new token is signed with kid %v", parsed.Header["kid"])
+	}
+	if err := verify(during, legacy); err == nil {
+		t.Fatal("token without kid is checked against a key other than the signing one")
+	}
+
+	after, err := NewKeySet(&JWTConfig{SigningKeyID: "new", Keys: []*JWTKey{newKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(after, oldToken); err == nil {
+		t.Fatal("token of a dropped key is accepted")
+	}
+	if err := verify(after, newToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(before, legacy); err != nil {
+		t.Fatalf("token without kid is rejected by its signing key: %v", err)
+	}
+}
+
+func TestNewKeySetErrors(t *testing.T) {
+	hs := &JWTKey{ID: "hs", Algorithm: "HS256", Secret: "secret"}
+	tests := []struct {
+		name   string
+		config *JWTConfig
+	}{
+		{"key without id", &JWTConfig{SigningKeyID: "hs", Keys: []*JWTKey{{Algorithm: "HS256", Secret: "secret"}}}},
+		{"duplicate id", &JWTConfig{SigningKeyID: "hs", Keys: []*JWTKey{hs, hs}}},
+		{"empty secret", &JWTConfig{SigningKeyID: "hs", Keys: []*JWTKey{{ID: "hs", Algorithm: "HS256"}}}},
+		{"unknown algorithm", &JWTConfig{SigningKeyID: "hs", Keys: []*JWTKey{{ID: "hs", Algorithm: "none"}}}},
+		{"missing signing key", &JWTConfig{SigningKeyID: "other", Keys: []*JWTKey{hs}}},
+		{"asymmetric key without files", &JWTConfig{SigningKeyID: "hs", Keys: []*JWTKey{hs, {ID: "rs", Algorithm: "RS256"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeySet(tt.config); err == nil {
+				t.Fatal("config is accepted")
+			}
+		})
+	}
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &JWTConfig{Keys: []*JWTKey{
+		{ID: "hs", Algorithm: "HS256", Secret: "secret"},
+		{ID: "rs", Algorithm: "RS256", PrivateKeyFile: writePrivateKey(t, rsaKey)},
+		{ID: "es", Algorithm: "ES256", PrivateKeyFile: writePrivateKey(t, ecKey)},
+		{ID: "ed", Algorithm: "EdDSA", PrivateKeyFile: writePrivateKey(t, edKey)},
+	}}
+
+	for _, id := range []string{"rs", "es", "ed"} {
+		t.Run(id, func(t *testing.T) {
+			config.SigningKeyID = id
+			ks, err := NewKeySet(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := ks.Sign(jwt.MapClaims{"sub": "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verify(ks, token); err != nil {
+				t.Fatal(err)
+			}
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 3 {
+				t.Fatalf("JWKS has %d keys, want the 3 public ones", len(jwks.Keys))
+			}
+			for _, k := range jwks.Keys {
+				if k.Kid == "hs" {
+					t.Fatal("HS256 secret is published")
+				}
+			}
+		})
+	}
+
+	//A token must not pick HS256 with the public key as the secret
+	config.SigningKeyID = "rs"
+	ks, err := NewKeySet(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "mallory"})
+	forged.Header["kid"] = "rs"
+	signed, err := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(ks, signed); err == nil {
+		t.Fatal("HS256 token verified with the RS256 public key")
+	}
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the id of a request, taken from the client or assigned
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds ids sent by clients, longer ones are replaced
+const maxRequestIDLength = 128
+
+type contextKey int
+
+const (
+	logEntryKey contextKey = iota
+	requestInfoKey
+)
+
+// requestInfo is filled in while the request is served and logged once it is done
+type requestInfo struct {
+	user string
+}
+
+// AccessLog assigns every request an id, propagated from X-Request-ID if the client sent one,
+// and puts a logrus entry with the id, method and route on the context, see LogEntry.
+// When the request is done, one line with method, route, status, bytes, latency,
+// user and request id is written to access.
+func AccessLog(logger *logrus.Logger, access *logrus.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			fields := logrus.Fields{
+				"request_id": id,
+				"method":     r.Method,
+				"route":      RouteTemplate(r),
+			}
+			if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+				fields["trace_id"] = sc.TraceID().String()
+			}
+			info := &requestInfo{}
+			ctx := context.WithValue(r.Context(), logEntryKey, logger.WithFields(fields))
+			ctx = context.WithValue(ctx, requestInfoKey, info)
+			sw := NewStatusWriter(w)
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			fields["path"] = r.URL.Path
+			fields["status"] = sw.Status()
+			fields["bytes"] = sw.Bytes()
+			fields["latency_ms"] = float64(time.Since(start).Microseconds()) / 1000
+			fields["remote_addr"] = r.RemoteAddr
+			if info.user != "" {
+				fields["user"] = info.user
+			}
+			access.WithFields(fields).Info("access")
+		})
+	}
+}
+
+// LogEntry is the logger of the request put on the context by AccessLog, nil outside of it
+func LogEntry(ctx context.Context) *logrus.Entry {
+	entry, _ := ctx.Value(logEntryKey).(*logrus.Entry)
+	return entry
+}
+
+// withUser names the authenticated user in the log entry and the access line of the request
+func withUser(r *http.Request, user string) *http.Request {
+	if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+		info.user = user
+	}
+	if entry := LogEntry(r.Context()); entry != nil {
+		return r.WithContext(context.WithValue(r.Context(), logEntryKey, entry.WithField("user", user)))
+	}
+	return r
+}
+
+// validRequestID accepts up to maxRequestIDLength visible ASCII characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(raw)
+}
+
+// RouteTemplate is the path template of the mux route that matched r, e.g. /api/v1/auto/{mark},
+// or "unmatched"
+func RouteTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
+
+// StatusWriter remembers the status code and the body size of the response
+type StatusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// NewStatusWriter wraps w, the status is 200 until another one is written
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *StatusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *StatusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status code of the response
+func (w *StatusWriter) Status() int {
+	return w.status
+}
+
+// Bytes of the body written so far
+func (w *StatusWriter) Bytes() int64 {
+	return w.bytes
+}
@@ -1,18 +1,207 @@
 package middleware
 
 import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+	"github.com/Konatavi/go2HW2/internal/app/problem"
 	jwtmiddleware "github.com/auth0/go-jwt-middleware"
 	"github.com/form3tech-oss/jwt-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// Problems the middleware answers with
 var (
-	SecretKey      []byte      = []byte("UltraRestApiSectryKey99999")
-	emptyValidFunc jwt.Keyfunc = func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
-	}
+	errUnauthorized          = problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "Valid bearer token required")
+	errTokenRevoked          = problem.New(http.StatusUnauthorized, problem.CodeTokenRevoked, "Token has been revoked")
+	errRevocationUnavailable = problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, "Can not check token revocation")
+	errForbidden             = problem.New(http.StatusForbidden, problem.CodeForbidden, "Not allowed")
+	errRoleUnavailable       = problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, "Can not check user role")
 )
 
-var JwtMiddleware = jwtmiddleware.New(jwtmiddleware.Options{
-	ValidationKeyGetter: emptyValidFunc,
-	SigningMethod:       jwt.SigningMethodHS256,
-})
+// userProperty is the context key of the accepted token, the default of jwtmiddleware
+const userProperty = "user"
+
+var tracer = otel.Tracer("github.com/Konatavi/go2HW2/internal/app/middleware")
+
+// Reasons JWTAuth reports to OnFailure
+const (
+	FailureRejected = "rejected"
+	FailureExpired  = "expired"
+	FailureRevoked  = "revoked"
+)
+
+// Denylist tells whether an access token was revoked before it expired
+type Denylist interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// JWTAuth checks Bearer tokens against a KeySet and a Denylist.
+// The KeySet can be replaced while serving, e.g. on config reload.
+type JWTAuth struct {
+	jwt      *jwtmiddleware.JWTMiddleware
+	denylist Denylist
+	mu       sync.RWMutex
+	keys     *KeySet
+	// onFailure is told why a token was not accepted
+	onFailure func(reason string)
+}
+
+// NewJwtMiddleware checks Bearer tokens against the keys of ks and the denylist
+func NewJwtMiddleware(ks *KeySet, denylist Denylist) *JWTAuth {
+	a := &JWTAuth{
+		denylist: denylist,
+		keys:     ks,
+	}
+	a.jwt = jwtmiddleware.New(jwtmiddleware.Options{
+		ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
+			return a.Keys().Keyfunc(token)
+		},
+		UserProperty: userProperty,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err string) {
+			//jwt-go reports expiry of MapClaims only as this message
+			if strings.Contains(err, "Token is expired") {
+				a.failure(FailureExpired)
+			} else {
+				a.failure(FailureRejected)
+			}
+			problem.Write(w, r, errUnauthorized.WithDetail(err))
+		},
+	})
+	return a
+}
+
+// OnFailure makes JWTAuth call f with the reason of every token it does not accept,
+// one of FailureRejected, FailureExpired and FailureRevoked. Set it before serving.
+func (a *JWTAuth) OnFailure(f func(reason string)) {
+	a.onFailure = f
+}
+
+func (a *JWTAuth) failure(reason string) {
+	if a.onFailure != nil {
+		a.onFailure(reason)
+	}
+}
+
+// Keys returns the current KeySet
+func (a *JWTAuth) Keys() *KeySet {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.keys
+}
+
+// SetKeys replaces the KeySet for tokens issued and checked from now on
+func (a *JWTAuth) SetKeys(ks *KeySet) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = ks
+}
+
+// Handler lets only requests with a valid, not revoked token through to h.
+// The check gets its own span, h runs in the span of the request.
+func (a *JWTAuth) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := a.verify(w, r)
+		if !ok {
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), userProperty, token))
+		if name, _ := Claims(r)["name"].(string); name != "" {
+			r = withUser(r, name)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// verify checks the token of r in span "jwt.verify". If it is not accepted,
+// verify answers with a problem and returns false.
+func (a *JWTAuth) verify(w http.ResponseWriter, r *http.Request) (*jwt.Token, bool) {
+	ctx, span := tracer.Start(r.Context(), "jwt.verify")
+	defer span.End()
+	//CheckJWT puts the token into the context of the request it is given
+	r = r.WithContext(ctx)
+	if err := a.jwt.CheckJWT(w, r); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, false
+	}
+	token, _ := r.Context().Value(userProperty).(*jwt.Token)
+	claims := Claims(r)
+	name, _ := claims["name"].(string)
+	role, _ := claims["role"].(string)
+	span.SetAttributes(attribute.String("enduser.id", name), attribute.String("enduser.role", role))
+
+	jti, _ := claims["jti"].(string)
+	if jti != "" {
+		revoked, err := a.denylist.IsRevoked(r.Context(), jti)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			problem.Write(w, r, errRevocationUnavailable)
+			return nil, false
+		}
+		if revoked {
+			span.SetStatus(codes.Error, "token revoked")
+			a.failure(FailureRevoked)
+			problem.Write(w, r, errTokenRevoked)
+			return nil, false
+		}
+	}
+	return token, true
+}
+
+// Subject is the name claim of a valid bearer token of r, "" if there is none.
+// It does not consult the denylist and answers nothing, e.g. to pick a rate limit bucket
+// before the route checks the token.
+func (a *JWTAuth) Subject(r *http.Request) string {
+	raw, err := jwtmiddleware.FromAuthHeader(r)
+	if err != nil || raw == "" {
+		return ""
+	}
+	token, err := jwt.Parse(raw, a.Keys().Keyfunc)
+	if err != nil || !token.Valid {
+		return ""
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	name, _ := claims["name"].(string)
+	return name
+}
+
+// Claims of the token JWTAuth accepted for the request
+func Claims(r *http.Request) jwt.MapClaims {
+	token, ok := r.Context().Value(userProperty).(*jwt.Token)
+	if !ok {
+		return jwt.MapClaims{}
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return claims
+}
+
+// RoleLookup returns the current role of the user, ok is false if there is no such user
+type RoleLookup func(ctx context.Context, username string) (role string, ok bool, err error)
+
+// RequireRole lets through only users whose role is at least role. Must be wrapped by JWTAuth.Handler.
+// The role is looked up on every request rather than taken from the role claim,
+// so a demoted user loses access at once and not when their access token expires.
+func RequireRole(lookup RoleLookup, role string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _ := Claims(r)["name"].(string)
+		userRole, ok, err := lookup(r.Context(), username)
+		if err != nil {
+			problem.Write(w, r, errRoleUnavailable)
+			return
+		}
+		if !ok {
+			problem.Write(w, r, errUnauthorized.WithDetail("User of the token does not exist"))
+			return
+		}
+		if !models.RoleAllows(userRole, role) {
+			problem.Write(w, r, errForbidden.WithDetail("Role "+role+" required"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
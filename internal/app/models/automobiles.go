@@ -1,11 +1,20 @@
 package models
 
+import "github.com/Konatavi/go2HW2/internal/app/validation"
+
 //Article models...
 type Automobiles struct {
 	ID       int    `json:"id"`
-	Mark     string `json:"mark"`
-	Maxspeed int    `json:"max_speed"`
-	Distance int    `json:"distance"`
-	Handler  string `json:"handler"`
-	Stock    string `json:"stock"`
+	Mark     string `json:"mark" validate:"required,max=64"`
+	Maxspeed int    `json:"max_speed" validate:"min=0,max=1000"`
+	Distance int    `json:"distance" validate:"min=0"`
+	Handler  string `json:"handler" validate:"max=255"`
+	Stock    string `json:"stock" validate:"max=255"`
+	// Version grows by one on every update, it is the ETag of the auto
+	Version int `json:"version"`
+}
+
+// Validate checks the validate rules of the fields
+func (a *Automobiles) Validate() error {
+	return validation.Struct(a)
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// IdempotencyKey remembers the first response to a request sent with an Idempotency-Key header.
+// Keys are unique per Scope, the user who sent the request.
+type IdempotencyKey struct {
+	Scope string
+	Key   string
+	// RequestHash is the SHA-256 of method, path and body, a retry must match it
+	RequestHash string
+	// StatusCode is 0 while the first request is still being handled
+	StatusCode     int
+	ResponseHeader http.Header
+	ResponseBody   []byte
+	CreatedAt      time.Time
+	// ExpiresAt is the end of the lease while StatusCode is 0, then the end of idempotency_ttl
+	ExpiresAt time.Time
+}
+
+// Completed reports whether the response is stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
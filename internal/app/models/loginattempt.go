@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Outcomes of a login attempt
+const (
+	LoginSucceeded   = "success"
+	LoginBadPassword = "bad_password"
+	LoginUnknownUser = "unknown_user"
+	// LoginLocked - the username was locked out for the IP after too many failures from it, the password was not checked
+	LoginLocked = "locked"
+	// LoginPending - the password is being checked. Pending attempts count as failures,
+	// so parallel guesses can not get past the lockout
+	LoginPending = "pending"
+	// LoginMalformed - the body was not a valid login request
+	LoginMalformed = "malformed"
+	// LoginError - the password could not be checked, e.g. the store was unavailable
+	LoginError = "error"
+)
+
+var loginOutcomes = map[string]bool{
+	LoginSucceeded:   true,
+	LoginBadPassword: true,
+	LoginUnknownUser: true,
+	LoginLocked:      true,
+	LoginPending:     true,
+	LoginMalformed:   true,
+	LoginError:       true,
+}
+
+// ValidLoginOutcome reports whether outcome is one of the known outcomes
+func ValidLoginOutcome(outcome string) bool {
+	return loginOutcomes[outcome]
+}
+
+// LoginAttempt is one POST /auth, kept for auditing and to lock out guessed accounts
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Outcome   string    `json:"outcome"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Failed reports whether the attempt counts towards the lockout
+func (a *LoginAttempt) Failed() bool {
+	return a.Outcome == LoginBadPassword || a.Outcome == LoginUnknownUser || a.Outcome == LoginPending
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RefreshToken is a single-use token exchanged for a new token pair.
+// Only the SHA-256 of the token is stored.
+type RefreshToken struct {
+	ID        int
+	TokenHash string
+	Username  string
+	ExpiresAt time.Time
+	// UsedAt is set once the token was exchanged or revoked
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -1,8 +1,87 @@
 package models
 
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/Konatavi/go2HW2/internal/app/validation"
+	"golang.org/x/crypto/bcrypt"
+)
+
 //User model ...
 type Usersauto struct {
 	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,max=64"`
+	// Password is a bcrypt hash once stored. Rows created before hashing may still hold plaintext.
+	// bcrypt ignores everything after 72 bytes, so longer passwords are refused rather than cut off
+	Password string `json:"password" validate:"required,min=8,maxbytes=72"`
+	// Role is one of RoleViewer, RoleEditor, RoleAdmin
+	Role string `json:"role" validate:"oneof=viewer editor admin"`
+}
+
+// Validate checks the validate rules of the fields, the password must still be plaintext
+func (u *Usersauto) Validate() error {
+	return validation.Struct(u)
+}
+
+// MarshalJSON never writes the password back out
+func (u Usersauto) MarshalJSON() ([]byte, error) {
+	type usersauto Usersauto
+	return json.Marshal(struct {
+		usersauto
+		Password string `json:"password,omitempty"`
+	}{usersauto: usersauto(u)})
+}
+
+// EncryptPassword replaces Password with its salted bcrypt hash. Password is always taken as plaintext,
+// even if it looks like a hash; whether a stored password is hashed is asked by PasswordNeedsRehash
+func (u *Usersauto) EncryptPassword() error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.Password = string(hash)
+	return nil
+}
+
+// PasswordIsHashed reports whether Password holds a bcrypt hash rather than plaintext
+func (u *Usersauto) PasswordIsHashed() bool {
+	return strings.HasPrefix(u.Password, "$2a$") ||
+		strings.HasPrefix(u.Password, "$2b$") ||
+		strings.HasPrefix(u.Password, "$2y$")
+}
+
+// ComparePassword checks password against the stored one in constant time
+func (u *Usersauto) ComparePassword(password string) bool {
+	if !u.PasswordIsHashed() {
+		return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
 }
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// DummyComparePassword spends as long as ComparePassword of a stored user,
+// so a login with an unknown username can not be told apart by its timing
+func DummyComparePassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// PasswordNeedsRehash reports whether the stored password should be hashed again
+// after a successful login: it is still plaintext or was hashed with a weaker cost.
+func (u *Usersauto) PasswordNeedsRehash() bool {
+	if !u.PasswordIsHashed() {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(u.Password))
+	return err != nil || cost < bcrypt.DefaultCost
+}
+
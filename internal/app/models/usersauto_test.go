@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/validation"
+)
+
+func TestEncryptPasswordHashesEveryInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+	}{
+		{"plain", "password1"},
+		{"looks like 2a hash", "$2a$10$abcdefgh"},
+		{"looks like 2b hash", "$2b$10$abcdefgh"},
+		{"looks like 2y hash", "$2y$10$abcdefgh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &Usersauto{Username: "alice", Password: tt.password}
+			if err := u.EncryptPassword(); err != nil {
+				t.Fatal(err)
+			}
+			if u.Password == tt.password {
+				t.Fatalf("password %q was stored as it is", tt.password)
+			}
+			if !u.ComparePassword(tt.password) {
+				t.Fatalf("password %q does not match its hash", tt.password)
+			}
+			if u.PasswordNeedsRehash() {
+				t.Fatal("fresh hash needs a rehash")
+			}
+		})
+	}
+}
+
+func TestPlaintextPasswordNeedsRehash(t *testing.T) {
+	u := &Usersauto{Username: "alice", Password: "password1"}
+	if !u.ComparePassword("password1") || u.ComparePassword("password2") {
+		t.Fatal("plaintext password is compared wrong")
+	}
+	if !u.PasswordNeedsRehash() {
+		t.Fatal("plaintext password does not need a rehash")
+	}
+}
+
+func TestPasswordLengthInBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"72 ascii bytes", strings.Repeat("a", 72), true},
+		{"73 ascii bytes", strings.Repeat("a", 73), false},
+		{"36 runes of 2 bytes", strings.Repeat("ж", 36), true},
+		{"40 runes of 2 bytes", strings.Repeat("ж", 40), false},
+		{"too short", "short", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &Usersauto{Username: "alice", Password: tt.password, Role: RoleViewer}
+			err := u.Validate()
+			var fieldErrs validation.Errors
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.valid && !errors.As(err, &fieldErrs) {
+				t.Fatalf("want validation errors, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Package problem writes error responses as RFC 7807 application/problem+json.
+//
+// Every problem carries a stable Code that clients can switch on, the Title and Detail
+// are for humans and may change.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType of problem responses
+const ContentType = "application/problem+json"
+
+// TypePrefix is put in front of the code to build the problem type URI
+const TypePrefix = "urn:go2hw2:problem:"
+
+// Stable problem codes
+const (
+	CodeInvalidJSON         = "invalid_json"
+	CodeBodyTooLarge        = "body_too_large"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodeInvalidPatch        = "invalid_patch"
+	CodePatchFailed         = "patch_failed"
+	CodeInvalidQuery        = "invalid_query"
+	CodeInvalidRole         = "invalid_role"
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeInvalidRefreshToken = "invalid_refresh_token"
+	CodeUnauthorized        = "unauthorized"
+	CodeTokenRevoked        = "token_revoked"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodePreconditionFailed  = "precondition_failed"
+	CodeUnavailable         = "unavailable"
+	CodeInternal            = "internal"
+	CodeInvalidIdempotency  = "invalid_idempotency_key"
+	CodeIdempotencyReused   = "idempotency_key_reused"
+	CodeIdempotencyInUse    = "idempotency_key_in_use"
+	CodeRateLimited         = "rate_limited"
+	CodeLoginLocked         = "login_locked"
+)
+
+// Problem is the body of an error response. It is an error itself, so handlers can return it
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// InvalidParams lists the fields of a validation_failed problem
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam is one field of the request that broke a rule
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// New problem with the title as its generic description
+func New(status int, code string, title string) *Problem {
+	return &Problem{
+		Type:   TypePrefix + code,
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+// WithDetail returns a copy of p explaining this occurrence
+func (p *Problem) WithDetail(detail string) *Problem {
+	c := *p
+	c.Detail = detail
+	return &c
+}
+
+// Write sends p with the request path as its instance
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	c := *p
+	if c.Instance == "" && r != nil {
+		c.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(c.Status)
+	json.NewEncoder(w).Encode(c)
+}
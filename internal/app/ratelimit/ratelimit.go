@@ -0,0 +1,230 @@
+// Package ratelimit limits requests per route with token buckets.
+//
+// Every route with a Rule gets one bucket per client, named by the KeyFunc of the Limiter,
+// e.g. per user for requests with a valid token and per IP for anonymous routes.
+// A bucket holds up to Burst tokens and refills Requests tokens every Per.
+// Requests finding it empty are answered with 429.
+// Buckets live in a Store, MemoryStore for a single instance or a shared one for several.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/middleware"
+	"github.com/Konatavi/go2HW2/internal/app/problem"
+)
+
+// Config of rate limiting
+type Config struct {
+	Enabled bool `toml:"enabled"`
+	// TrustProxy takes the client IP from the last X-Forwarded-For address.
+	// Turn it on only behind a reverse proxy that sets the header
+	TrustProxy bool `toml:"trust_proxy"`
+	// Routes without a rule are not limited
+	Routes []Rule `toml:"routes"`
+}
+
+// Rule limits one route to Requests every Per, with bursts of up to Burst requests
+type Rule struct {
+	// Route is the mux path template, e.g. /api/v1/auto/{mark}
+	Route    string        `toml:"route"`
+	Requests int           `toml:"requests"`
+	Per      time.Duration `toml:"per"`
+	// Burst is the size of the bucket, Requests if 0
+	Burst int `toml:"burst"`
+}
+
+// NewConfig returns the default config, limiting the routes that take passwords and refresh tokens
+func NewConfig() *Config {
+	return &Config{
+		Enabled: true,
+		Routes: []Rule{
+			{Route: "/api/v1/auth", Requests: 10, Per: time.Minute, Burst: 5},
+			{Route: "/api/v1/register", Requests: 5, Per: time.Minute, Burst: 5},
+			{Route: "/api/v1/auth/refresh", Requests: 30, Per: time.Minute, Burst: 10},
+		},
+	}
+}
+
+// Validate lists the problems of the config
+func (c *Config) Validate() []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, r := range c.Routes {
+		key := fmt.Sprintf("rate_limit.routes[%d]", i)
+		if r.Route == "" {
+			problems = append(problems, key+".route is required")
+		} else if seen[r.Route] {
+			problems = append(problems, fmt.Sprintf("%s.route %q has another rule already", key, r.Route))
+		}
+		seen[r.Route] = true
+		if r.Requests <= 0 {
+			problems = append(problems, fmt.Sprintf("%s.requests %d must be positive", key, r.Requests))
+		}
+		if r.Per <= 0 {
+			problems = append(problems, fmt.Sprintf("%s.per %s must be positive", key, r.Per))
+		}
+		if r.Burst < 0 {
+			problems = append(problems, fmt.Sprintf("%s.burst %d must not be negative", key, r.Burst))
+		}
+	}
+	return problems
+}
+
+// Limit is a token bucket: Burst tokens at most, refilled at Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (r Rule) limit() Limit {
+	burst := r.Burst
+	if burst == 0 {
+		burst = r.Requests
+	}
+	return Limit{Rate: float64(r.Requests) / r.Per.Seconds(), Burst: burst}
+}
+
+// Result of taking a token
+type Result struct {
+	Allowed bool
+	// Remaining tokens in the bucket
+	Remaining int
+	// RetryAfter is when the next token is there, 0 if the request was allowed
+	RetryAfter time.Duration
+	// Reset is when the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps the buckets. Implementations shared by several instances, e.g. in Redis,
+// must take the token atomically.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// KeyFunc names the client a request is counted for, e.g. "user:bob" or "ip:10.0.0.1"
+type KeyFunc func(r *http.Request) string
+
+var errRateLimited = problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "Too many requests")
+
+// Limiter applies the rules of a Config. The config can be replaced while serving
+type Limiter struct {
+	store Store
+	key   KeyFunc
+	mu    sync.RWMutex
+	cfg   *Config
+	rules map[string]Rule
+	// onLimited is told about every request answered with 429
+	onLimited func(r *http.Request)
+}
+
+// New limiter taking tokens from store for the clients named by key
+func New(c *Config, store Store, key KeyFunc) *Limiter {
+	l := &Limiter{store: store, key: key}
+	l.SetConfig(c)
+	return l
+}
+
+// SetConfig replaces the rules, buckets of routes that keep their rule are kept
+func (l *Limiter) SetConfig(c *Config) {
+	rules := make(map[string]Rule, len(c.Routes))
+	for _, r := range c.Routes {
+		rules[r.Route] = r
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = c
+	l.rules = rules
+}
+
+func (l *Limiter) rule(route string) (Rule, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if !l.cfg.Enabled {
+		return Rule{}, false
+	}
+	r, ok := l.rules[route]
+	return r, ok
+}
+
+// OnLimited makes the limiter call f with every request it refuses, before answering it.
+// Set it before serving
+func (l *Limiter) OnLimited(f func(r *http.Request)) {
+	l.onLimited = f
+}
+
+// TrustProxy reports whether client IPs are taken from X-Forwarded-For
+func (l *Limiter) TrustProxy() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cfg.TrustProxy
+}
+
+// Middleware answers requests over the limit of their route with 429, use it with Router.Use.
+// Responses of limited routes carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset.
+// If the store fails, requests are let through.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := middleware.RouteTemplate(r)
+		rule, ok := l.rule(route)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limit := rule.limit()
+		res, err := l.store.Take(r.Context(), route+" "+l.key(r), limit, time.Now())
+		if err != nil {
+			if entry := middleware.LogEntry(r.Context()); entry != nil {
+				entry.WithError(err).Warn("Rate limit store failed, request let through")
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", rule.Requests, int(math.Ceil(rule.Per.Seconds())), limit.Burst))
+		h.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+		if !res.Allowed {
+			if l.onLimited != nil {
+				l.onLimited(r)
+			}
+			retryAfter := seconds(res.RetryAfter)
+			h.Set("Retry-After", strconv.Itoa(retryAfter))
+			problem.Write(w, r, errRateLimited.WithDetail(fmt.Sprintf("limit of %s is %d requests per %s, retry in %d s", route, rule.Requests, rule.Per, retryAfter)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// seconds rounds up, so clients never retry too early
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP is the address of the client, the last X-Forwarded-For address if trustProxy
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		forwarded  []string
+		trustProxy bool
+		want       string
+	}{
+		{"remote address", nil, false, "10.0.0.1"},
+		{"forwarded ignored", []string{"192.0.2.7"}, false, "10.0.0.1"},
+		{"forwarded trusted", []string{"192.0.2.7"}, true, "192.0.2.7"},
+		{"last hop of the last header", []string{"198.51.100.1", "192.0.2.8, 192.0.2.7"}, true, "192.0.2.7"},
+		{"empty forwarded", []string{""}, true, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(r, tt.trustProxy); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
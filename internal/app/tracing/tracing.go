@@ -0,0 +1,164 @@
+// Package tracing sets up OpenTelemetry: the tracer provider with its exporter and
+// W3C trace context propagation. Spans are made by the router middleware, the JWT middleware,
+// the repository hook of this package and the SQL statements of the store.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Konatavi/go2HW2/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Supported exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// Config of tracing
+type Config struct {
+	// Exporter is one of none, stdout, file, otlp. With none no spans are recorded
+	Exporter string `toml:"exporter"`
+	// Endpoint of the OTLP/HTTP collector, host:port
+	Endpoint string `toml:"endpoint"`
+	// Insecure sends OTLP over plain HTTP
+	Insecure bool `toml:"insecure"`
+	// File the file exporter appends spans to, as JSON
+	File        string `toml:"file"`
+	ServiceName string `toml:"service_name"`
+	// SampleRatio of traces started here, traces with a sampled parent are always recorded
+	SampleRatio float64 `toml:"sample_ratio"`
+}
+
+// NewConfig returns the default config, tracing is off
+func NewConfig() *Config {
+	return &Config{
+		Exporter:    ExporterNone,
+		Endpoint:    "localhost:4318",
+		Insecure:    true,
+		File:        "traces.json",
+		ServiceName: "apiserver",
+		SampleRatio: 1,
+	}
+}
+
+// Validate lists the problems of the config
+func (c *Config) Validate() []string {
+	var problems []string
+	switch c.Exporter {
+	case ExporterNone, ExporterStdout:
+	case ExporterFile:
+		if c.File == "" {
+			problems = append(problems, "tracing.file is required for the file exporter")
+		}
+	case ExporterOTLP:
+		if c.Endpoint == "" {
+			problems = append(problems, "tracing.endpoint is required for the otlp exporter")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter %q is unknown, use one of none, stdout, file, otlp", c.Exporter))
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		problems = append(problems, fmt.Sprintf("tracing.sample_ratio %g is out of range [0, 1]", c.SampleRatio))
+	}
+	return problems
+}
+
+// Enabled reports whether spans are exported
+func (c *Config) Enabled() bool {
+	return c.Exporter != "" && c.Exporter != ExporterNone
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator.
+// The returned shutdown flushes the spans not exported yet.
+func Setup(ctx context.Context, c *Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !c.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var file io.Closer
+	switch c.Exporter {
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		var f *os.File
+		if f, err = os.OpenFile(c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		file = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(c.Endpoint)}
+		if c.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(c.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+var tracer = otel.Tracer("github.com/Konatavi/go2HW2/internal/app/tracing")
+
+// QueryHook starts a span for every repository call, e.g. "automobiles.SelectPage".
+// The SQL statements of the call are its children. Add it with store.AddQueryHook
+func QueryHook(ctx context.Context, repository string, operation string) (context.Context, func(err error)) {
+	ctx, span := tracer.Start(ctx, repository+"."+operation, trace.WithAttributes(
+		attribute.String("store.repository", repository),
+		attribute.String("store.operation", operation),
+	))
+	return ctx, func(err error) {
+		var storeErr *store.Error
+		switch {
+		case err == nil:
+		//Missing rows, conflicts and stale versions are answers, not failures of the store
+		case errors.As(err, &storeErr) && storeErr.Kind != store.ErrUnavailable:
+			span.SetAttributes(attribute.String("store.outcome", strings.ReplaceAll(storeErr.Kind.Error(), " ", "_")))
+		default:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
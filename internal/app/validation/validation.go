@@ -0,0 +1,147 @@
+// Package validation checks struct fields against rules declared in `validate` tags:
+//
+//	Name  string `json:"name" validate:"required,max=64"`
+//	Speed int    `json:"speed" validate:"min=0,max=1000"`
+//	Role  string `json:"role" validate:"oneof=viewer editor admin"`
+//
+// Rules are separated by commas:
+//
+//	required   - not the zero value
+//	min=N      - numbers at least N, strings at least N characters
+//	max=N      - numbers at most N, strings at most N characters
+//	maxbytes=N - strings at most N bytes of UTF-8, e.g. for bcrypt passwords
+//	oneof=A B  - one of the space separated values, empty strings pass unless required
+//
+// Fields are reported by their json name.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError is one broken rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors are all broken rules of a value
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// Struct checks every tagged field of the struct v points to.
+// It returns nil or Errors listing every broken rule.
+func Struct(v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: %T is not a struct", v))
+	}
+	var errs Errors
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || sf.PkgPath != "" {
+			continue
+		}
+		name := fieldName(sf)
+		for _, rule := range strings.Split(tag, ",") {
+			if msg := check(rv.Field(i), rule); msg != "" {
+				ruleName := strings.SplitN(rule, "=", 2)[0]
+				errs = append(errs, FieldError{Field: name, Rule: ruleName, Message: msg})
+				// the other rules make no sense for a missing value
+				if ruleName == "required" {
+					break
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func fieldName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
+
+// check returns why v breaks rule, or "" if it does not
+func check(v reflect.Value, rule string) string {
+	name, arg := rule, ""
+	if i := strings.IndexByte(rule, '='); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validation: bad %s limit %q", name, arg))
+		}
+		n, unit := measure(v)
+		if name == "min" && n < limit {
+			return fmt.Sprintf("must be at least %s%s", arg, unit)
+		}
+		if name == "max" && n > limit {
+			return fmt.Sprintf("must be at most %s%s", arg, unit)
+		}
+	case "maxbytes":
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validation: bad %s limit %q", name, arg))
+		}
+		if len(v.String()) > limit {
+			return fmt.Sprintf("must be at most %s bytes", arg)
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		if s == "" {
+			return ""
+		}
+		for _, allowed := range strings.Fields(arg) {
+			if s == allowed {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(strings.Fields(arg), ", ")
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", rule))
+	}
+	return ""
+}
+
+// measure is the value of numbers and the length of strings and slices
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	panic(fmt.Sprintf("validation: can not measure %s", v.Type()))
+}
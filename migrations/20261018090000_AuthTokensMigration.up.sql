@@ -0,0 +1,15 @@
+CREATE TABLE refresh_tokens (
+    id bigserial not null primary key,
+    token_hash varchar not null unique,
+    username varchar not null,
+    expires_at timestamptz not null,
+    used_at timestamptz,
+    created_at timestamptz not null default now()
+);
+
+CREATE INDEX refresh_tokens_username_idx ON refresh_tokens (username);
+
+CREATE TABLE revoked_tokens (
+    jti varchar not null primary key,
+    expires_at timestamptz not null
+);
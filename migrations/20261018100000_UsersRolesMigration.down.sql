@@ -0,0 +1 @@
+ALTER TABLE usersauto DROP COLUMN role;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE usersauto ADD COLUMN role varchar not null default 'viewer'
+    CHECK (role IN ('viewer', 'editor', 'admin'));
@@ -0,0 +1 @@
+ALTER TABLE automobiles DROP COLUMN version;
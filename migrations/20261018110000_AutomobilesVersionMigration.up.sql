@@ -0,0 +1 @@
+ALTER TABLE automobiles ADD COLUMN version integer not null default 1;
@@ -0,0 +1,13 @@
+CREATE TABLE idempotency_keys (
+    scope varchar not null,
+    key varchar not null,
+    request_hash varchar not null,
+    status_code integer,
+    response_header jsonb,
+    response_body bytea,
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    primary key (scope, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
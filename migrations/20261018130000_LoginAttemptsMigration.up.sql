@@ -0,0 +1,11 @@
+CREATE TABLE login_attempts (
+    id bigserial not null primary key,
+    username varchar not null,
+    ip varchar not null,
+    user_agent varchar not null default '',
+    outcome varchar not null,
+    created_at timestamptz not null default now()
+);
+
+CREATE INDEX login_attempts_username_ip_created_at_idx ON login_attempts (username, ip, created_at);
+CREATE INDEX login_attempts_created_at_idx ON login_attempts (created_at);
@@ -0,0 +1,27 @@
+// Package migrations embeds the SQL schema migrations into the binary.
+// Files follow golang-migrate naming: <version>_<name>.up.sql / .down.sql
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// Latest returns the version of the newest embedded migration
+func Latest() uint {
+	entries, _ := fs.ReadDir(FS, ".")
+	var latest uint
+	for _, e := range entries {
+		raw := strings.SplitN(e.Name(), "_", 2)[0]
+		version, err := strconv.ParseUint(raw, 10, 64)
+		if err == nil && uint(version) > latest {
+			latest = uint(version)
+		}
+	}
+	return latest
+}
@@ -0,0 +1,79 @@
+package store
+
+import "github.com/Konatavi/go2HW2/internal/app/models"
+
+// AutomobilePatch lists the columns PatchByMark changes, nil fields keep their value
+type AutomobilePatch struct {
+	Mark     *string
+	Maxspeed *int
+	Distance *int
+	Handler  *string
+	Stock    *string
+}
+
+// NewAutomobilePatch holds the fields of to that differ from from
+func NewAutomobilePatch(from, to *models.Automobiles) *AutomobilePatch {
+	p := &AutomobilePatch{}
+	if to.Mark != from.Mark {
+		p.Mark = &to.Mark
+	}
+	if to.Maxspeed != from.Maxspeed {
+		p.Maxspeed = &to.Maxspeed
+	}
+	if to.Distance != from.Distance {
+		p.Distance = &to.Distance
+	}
+	if to.Handler != from.Handler {
+		p.Handler = &to.Handler
+	}
+	if to.Stock != from.Stock {
+		p.Stock = &to.Stock
+	}
+	return p
+}
+
+// IsEmpty reports whether the patch changes nothing
+func (p *AutomobilePatch) IsEmpty() bool {
+	return p.Mark == nil && p.Maxspeed == nil && p.Distance == nil && p.Handler == nil && p.Stock == nil
+}
+
+// columns of the patch with their new values, in table order
+func (p *AutomobilePatch) columns() ([]string, []interface{}) {
+	var columns []string
+	var values []interface{}
+	if p.Mark != nil {
+		columns, values = append(columns, "mark"), append(values, *p.Mark)
+	}
+	if p.Maxspeed != nil {
+		columns, values = append(columns, "maxspeed"), append(values, *p.Maxspeed)
+	}
+	if p.Distance != nil {
+		columns, values = append(columns, "distance"), append(values, *p.Distance)
+	}
+	if p.Handler != nil {
+		columns, values = append(columns, "handler"), append(values, *p.Handler)
+	}
+	if p.Stock != nil {
+		columns, values = append(columns, "stock"), append(values, *p.Stock)
+	}
+	return columns, values
+}
+
+// apply the patch to a
+func (p *AutomobilePatch) apply(a *models.Automobiles) {
+	if p.Mark != nil {
+		a.Mark = *p.Mark
+	}
+	if p.Maxspeed != nil {
+		a.Maxspeed = *p.Maxspeed
+	}
+	if p.Distance != nil {
+		a.Distance = *p.Distance
+	}
+	if p.Handler != nil {
+		a.Handler = *p.Handler
+	}
+	if p.Stock != nil {
+		a.Stock = *p.Stock
+	}
+}
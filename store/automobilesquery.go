@@ -0,0 +1,273 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// ErrInvalidQuery wraps every problem with AutomobilesQuery parameters
+var ErrInvalidQuery = errors.New("invalid query")
+
+// AutomobilesQuery describes which automobiles SelectPage returns.
+// Zero values mean "no restriction"; Limit 0 returns every matching row.
+type AutomobilesQuery struct {
+	Limit  int
+	Offset int
+	// Cursor is AutomobilesPage.NextCursor of the previous page. Can not be combined with Offset
+	Cursor string
+
+	MarkPrefix  string
+	Handler     string
+	Stock       string
+	MinMaxspeed *int
+	MaxMaxspeed *int
+	MinDistance *int
+	MaxDistance *int
+
+	// SortBy is a column or json name of models.Automobiles, "id" by default
+	SortBy   string
+	SortDesc bool
+}
+
+// AutomobilesPage is one page of SelectPage results
+type AutomobilesPage struct {
+	Automobiles []*models.Automobiles
+	// Total is the number of rows matching the filters, regardless of paging
+	Total int
+	// NextCursor is empty on the last page
+	NextCursor string
+}
+
+// sortable columns of automobiles by their column and json names
+var automobilesSortColumns = map[string]string{
+	"id":        "id",
+	"mark":      "mark",
+	"maxspeed":  "maxspeed",
+	"max_speed": "maxspeed",
+	"distance":  "distance",
+	"handler":   "handler",
+	"stock":     "stock",
+	"version":   "version",
+}
+
+// automobilesCursor is the decoded form of AutomobilesPage.NextCursor.
+// It remembers the sort key of the last row so the next page starts right after it.
+type automobilesCursor struct {
+	SortBy   string `json:"s"`
+	SortDesc bool   `json:"d"`
+	Value    string `json:"v"`
+	ID       int    `json:"id"`
+}
+
+// sortColumn validates the query and returns the column to sort by
+func (q *AutomobilesQuery) sortColumn() (string, error) {
+	if q.Limit < 0 || q.Offset < 0 {
+		return "", fmt.Errorf("%w: limit and offset must not be negative", ErrInvalidQuery)
+	}
+	if q.Cursor != "" && q.Offset > 0 {
+		return "", fmt.Errorf("%w: cursor can not be combined with offset", ErrInvalidQuery)
+	}
+	if q.SortBy == "" {
+		return "id", nil
+	}
+	column, ok := automobilesSortColumns[q.SortBy]
+	if !ok {
+		return "", fmt.Errorf("%w: can not sort by %q", ErrInvalidQuery, q.SortBy)
+	}
+	return column, nil
+}
+
+func (q *AutomobilesQuery) decodeCursor(column string) (*automobilesCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	c := &automobilesCursor{}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.SortBy != column || c.SortDesc != q.SortDesc {
+		return nil, fmt.Errorf("%w: cursor was issued for another sort order", ErrInvalidQuery)
+	}
+	if isIntColumn(column) {
+		if _, err := strconv.Atoi(c.Value); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+	}
+	return c, nil
+}
+
+func (q *AutomobilesQuery) encodeCursor(column string, last *models.Automobiles) string {
+	raw, _ := json.Marshal(automobilesCursor{
+		SortBy:   column,
+		SortDesc: q.SortDesc,
+		Value:    automobileColumnValue(last, column),
+		ID:       last.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func isIntColumn(column string) bool {
+	return column == "id" || column == "maxspeed" || column == "distance" || column == "version"
+}
+
+// sortExpression is column as it goes to ORDER BY and cursor comparisons.
+// Text columns are compared byte by byte under the "C" collation, the same way
+// compareAutomobiles orders them, so both drivers return pages in one order
+// whatever the collation of the database is.
+func sortExpression(column string) string {
+	if isIntColumn(column) {
+		return column
+	}
+	return column + ` COLLATE "C"`
+}
+
+// automobileColumnValue returns the value of column in a as it is kept in a cursor
+func automobileColumnValue(a *models.Automobiles, column string) string {
+	switch column {
+	case "mark":
+		return a.Mark
+	case "maxspeed":
+		return strconv.Itoa(a.Maxspeed)
+	case "distance":
+		return strconv.Itoa(a.Distance)
+	case "handler":
+		return a.Handler
+	case "stock":
+		return a.Stock
+	case "version":
+		return strconv.Itoa(a.Version)
+	default:
+		return strconv.Itoa(a.ID)
+	}
+}
+
+// setAutomobileColumnValue is the reverse of automobileColumnValue
+func setAutomobileColumnValue(a *models.Automobiles, column, value string) {
+	switch column {
+	case "mark":
+		a.Mark = value
+	case "maxspeed":
+		a.Maxspeed, _ = strconv.Atoi(value)
+	case "distance":
+		a.Distance, _ = strconv.Atoi(value)
+	case "handler":
+		a.Handler = value
+	case "stock":
+		a.Stock = value
+	case "version":
+		a.Version, _ = strconv.Atoi(value)
+	default:
+		a.ID, _ = strconv.Atoi(value)
+	}
+}
+
+// sqlBuilder collects WHERE conditions together with their positional arguments
+type sqlBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (b *sqlBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *sqlBuilder) where(format string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, v := range values {
+		placeholders[i] = b.arg(v)
+	}
+	b.conditions = append(b.conditions, fmt.Sprintf(format, placeholders...))
+}
+
+func (b *sqlBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// escapeLike escapes the LIKE wildcards of a user supplied prefix
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// filter adds the filtering part of the query, shared by the page and the count queries
+func (q *AutomobilesQuery) filter(b *sqlBuilder) {
+	if q.MarkPrefix != "" {
+		b.where("mark LIKE %s", escapeLike(q.MarkPrefix)+"%")
+	}
+	if q.Handler != "" {
+		b.where("handler = %s", q.Handler)
+	}
+	if q.Stock != "" {
+		b.where("stock = %s", q.Stock)
+	}
+	if q.MinMaxspeed != nil {
+		b.where("maxspeed >= %s", *q.MinMaxspeed)
+	}
+	if q.MaxMaxspeed != nil {
+		b.where("maxspeed <= %s", *q.MaxMaxspeed)
+	}
+	if q.MinDistance != nil {
+		b.where("distance >= %s", *q.MinDistance)
+	}
+	if q.MaxDistance != nil {
+		b.where("distance <= %s", *q.MaxDistance)
+	}
+}
+
+// matches is the in-memory counterpart of filter
+func (q *AutomobilesQuery) matches(a *models.Automobiles) bool {
+	switch {
+	case q.MarkPrefix != "" && !strings.HasPrefix(a.Mark, q.MarkPrefix):
+		return false
+	case q.Handler != "" && a.Handler != q.Handler:
+		return false
+	case q.Stock != "" && a.Stock != q.Stock:
+		return false
+	case q.MinMaxspeed != nil && a.Maxspeed < *q.MinMaxspeed:
+		return false
+	case q.MaxMaxspeed != nil && a.Maxspeed > *q.MaxMaxspeed:
+		return false
+	case q.MinDistance != nil && a.Distance < *q.MinDistance:
+		return false
+	case q.MaxDistance != nil && a.Distance > *q.MaxDistance:
+		return false
+	}
+	return true
+}
+
+// compareAutomobiles orders a and b by column and then by id, ascending.
+// Text is compared as bytes, see sortExpression
+func compareAutomobiles(a, b *models.Automobiles, column string) int {
+	if isIntColumn(column) {
+		av, _ := strconv.Atoi(automobileColumnValue(a, column))
+		bv, _ := strconv.Atoi(automobileColumnValue(b, column))
+		if av != bv {
+			if av < bv {
+				return -1
+			}
+			return 1
+		}
+	} else if c := strings.Compare(automobileColumnValue(a, column), automobileColumnValue(b, column)); c != 0 {
+		return c
+	}
+	switch {
+	case a.ID < b.ID:
+		return -1
+	case a.ID > b.ID:
+		return 1
+	}
+	return 0
+}
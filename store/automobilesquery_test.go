@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+func newTestAutomobiles(t *testing.T) *MemoryAutomobilesRepository {
+	t.Helper()
+	autos := NewMemoryAutomobilesRepository()
+	for _, a := range []*models.Automobiles{
+		{Mark: "bmw", Maxspeed: 250, Distance: 10, Handler: "ivan", Stock: "north"},
+		{Mark: "audi", Maxspeed: 240, Distance: 30, Handler: "ivan", Stock: "south"},
+		{Mark: "bmw_x5", Maxspeed: 230, Distance: 20, Handler: "petr", Stock: "north"},
+		{Mark: "Lada", Maxspeed: 180, Distance: 50, Handler: "petr", Stock: "north"},
+		{Mark: "kia", Maxspeed: 240, Distance: 40, Handler: "anna", Stock: "south"},
+	} {
+		if _, err := autos.Create(context.Background(), a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return autos
+}
+
+func marks(page *AutomobilesPage) []string {
+	m := make([]string, len(page.Automobiles))
+	for i, a := range page.Automobiles {
+		m[i] = a.Mark
+	}
+	return m
+}
+
+func intp(i int) *int { return &i }
+
+func TestSelectPageFilterAndSort(t *testing.T) {
+	ctx := context.Background()
+	autos := newTestAutomobiles(t)
+	tests := []struct {
+		name  string
+		q     AutomobilesQuery
+		want  []string
+		total int
+	}{
+		{"everything by id", AutomobilesQuery{}, []string{"bmw", "audi", "bmw_x5", "Lada", "kia"}, 5},
+		{"mark prefix", AutomobilesQuery{MarkPrefix: "bmw"}, []string{"bmw", "bmw_x5"}, 2},
+		{"prefix wildcard is literal", AutomobilesQuery{MarkPrefix: "bmw_"}, []string{"bmw_x5"}, 1},
+		{"handler and stock", AutomobilesQuery{Handler: "petr", Stock: "north"}, []string{"bmw_x5", "Lada"}, 2},
+		{"speed range", AutomobilesQuery{MinMaxspeed: intp(230), MaxMaxspeed: intp(240)}, []string{"audi", "bmw_x5", "kia"}, 3},
+		{"distance range", AutomobilesQuery{MinDistance: intp(20), MaxDistance: intp(40)}, []string{"audi", "bmw_x5", "kia"}, 3},
+		{"by mark as bytes", AutomobilesQuery{SortBy: "mark"}, []string{"Lada", "audi", "bmw", "bmw_x5", "kia"}, 5},
+		{"by json name, ties by id", AutomobilesQuery{SortBy: "max_speed", SortDesc: true}, []string{"bmw", "kia", "audi", "bmw_x5", "Lada"}, 5},
+		{"limit and offset", AutomobilesQuery{SortBy: "distance", Limit: 2, Offset: 1}, []string{"bmw_x5", "audi"}, 5},
+		{"offset past the end", AutomobilesQuery{Offset: 10}, []string{}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := autos.SelectPage(ctx, &tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := marks(page); !reflect.DeepEqual(got, tt.want) || page.Total != tt.total {
+				t.Fatalf("got %v of %d, want %v of %d", got, page.Total, tt.want, tt.total)
+			}
+		})
+	}
+}
+
+func TestSelectPageCursor(t *testing.T) {
+	ctx := context.Background()
+	autos := newTestAutomobiles(t)
+	for _, q := range []AutomobilesQuery{
+		{Limit: 2},
+		{Limit: 2, SortBy: "mark"},
+		{Limit: 2, SortBy: "maxspeed", SortDesc: true},
+		{Limit: 1, SortBy: "stock"},
+	} {
+		all, err := autos.SelectPage(ctx, &AutomobilesQuery{SortBy: q.SortBy, SortDesc: q.SortDesc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var walked []string
+		for pages := 0; ; pages++ {
+			if pages > len(all.Automobiles) {
+				t.Fatalf("%+v: cursor does not end", q)
+			}
+			page, err := autos.SelectPage(ctx, &q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			walked = append(walked, marks(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		if want := marks(all); !reflect.DeepEqual(walked, want) {
+			t.Fatalf("%+v: walked %v, want %v", q, walked, want)
+		}
+	}
+}
+
+func TestSelectPageInvalidQuery(t *testing.T) {
+	ctx := context.Background()
+	autos := newTestAutomobiles(t)
+	page, err := autos.SelectPage(ctx, &AutomobilesQuery{Limit: 1, SortBy: "mark"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		q    AutomobilesQuery
+	}{
+		{"negative limit", AutomobilesQuery{Limit: -1}},
+		{"negative offset", AutomobilesQuery{Offset: -1}},
+		{"cursor with offset", AutomobilesQuery{Cursor: page.NextCursor, SortBy: "mark", Offset: 1}},
+		{"unknown column", AutomobilesQuery{SortBy: "password"}},
+		{"cursor is not base64", AutomobilesQuery{Cursor: "!!!"}},
+		{"cursor is not json", AutomobilesQuery{Cursor: "bm90IGpzb24"}},
+		{"cursor of another column", AutomobilesQuery{Cursor: page.NextCursor, SortBy: "stock"}},
+		{"cursor of another direction", AutomobilesQuery{Cursor: page.NextCursor, SortBy: "mark", SortDesc: true}},
+		// {"s":"maxspeed","d":false,"v":"fast","id":1}
+		{"cursor with text in int column", AutomobilesQuery{Cursor: "eyJzIjoibWF4c3BlZWQiLCJkIjpmYWxzZSwidiI6ImZhc3QiLCJpZCI6MX0", SortBy: "maxspeed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := autos.SelectPage(ctx, &tt.q); !errors.Is(err, ErrInvalidQuery) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidQuery)
+			}
+		})
+	}
+}
+
+func TestSortExpression(t *testing.T) {
+	for column, want := range map[string]string{
+		"id":       "id",
+		"maxspeed": "maxspeed",
+		"mark":     `mark COLLATE "C"`,
+		"stock":    `stock COLLATE "C"`,
+	} {
+		if got := sortExpression(column); got != want {
+			t.Errorf("sortExpression(%q) = %s, want %s", column, got, want)
+		}
+	}
+}
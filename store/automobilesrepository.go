@@ -1,100 +1,242 @@
 package store
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 
 	"github.com/Konatavi/go2HW2/internal/app/models"
 )
 
-type AutomobilesRepository struct {
+// SQLAutomobilesRepository is AutomobilesRepository backed by postgres
+type SQLAutomobilesRepository struct {
 	store *Store
 }
 
 var (
-	tableAutomobiles string = "automobiles"
+	tableAutomobiles   string = "automobiles"
+	columnsAutomobiles string = "id, mark, maxspeed, distance, handler, stock, version"
 )
 
 //For Post request
-func (ar *AutomobilesRepository) Create(a *models.Automobiles) (*models.Automobiles, error) {
-	query := fmt.Sprintf("INSERT INTO %s (mark, maxspeed, distance, handler, stock) VALUES ($1, $2, $3, $4, $5) RETURNING id", tableAutomobiles)
-	if err := ar.store.db.QueryRow(query, a.Mark, a.Maxspeed, a.Distance, a.Handler, a.Stock).Scan(&a.ID); err != nil {
-		return nil, err
+func (ar *SQLAutomobilesRepository) Create(ctx context.Context, a *models.Automobiles) (*models.Automobiles, error) {
+	ctx, cancel := ar.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("INSERT INTO %s (mark, maxspeed, distance, handler, stock) VALUES ($1, $2, $3, $4, $5) RETURNING id, version", tableAutomobiles)
+	if err := ar.store.db.QueryRowContext(ctx, query, a.Mark, a.Maxspeed, a.Distance, a.Handler, a.Stock).Scan(&a.ID, &a.Version); err != nil {
+		return nil, sqlError(err, "auto %q", a.Mark)
 	}
 	return a, nil
 }
 
-//For DELETE request
-func (ar *AutomobilesRepository) DeleteByMark(mark string) (*models.Automobiles, error) {
-	article, ok, err := ar.FindAutomobileByMark(mark)
+//For DELETE request. ErrNotFound if there is no auto with that mark
+func (ar *SQLAutomobilesRepository) DeleteByMark(ctx context.Context, mark string, ifVersion int) error {
+	ctx, cancel := ar.store.withTimeout(ctx)
+	defer cancel()
+	b := &sqlBuilder{}
+	b.where("mark=%s", mark)
+	if ifVersion != 0 {
+		b.where("version=%s", ifVersion)
+	}
+	query := fmt.Sprintf("DELETE FROM %s%s", tableAutomobiles, b.whereClause())
+	res, err := ar.store.db.ExecContext(ctx, query, b.args...)
 	if err != nil {
-		return nil, err
+		return sqlError(err, "auto %q", mark)
 	}
-	if ok {
-		query := fmt.Sprintf("delete from %s where mark=$1", tableAutomobiles)
-		_, err = ar.store.db.Exec(query, mark)
-		if err != nil {
-			return nil, err
-		}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return sqlError(err, "auto %q", mark)
 	}
-
-	return article, nil
+	if affected == 0 {
+		return ar.missing(ctx, mark, ifVersion)
+	}
+	return nil
 }
 
-//Helper for find by mask and GET request
-func (ar *AutomobilesRepository) FindAutomobileByMark(mark string) (*models.Automobiles, bool, error) {
-	automobiles, err := ar.SelectAll()
-	founded := false
-	if err != nil {
-		return nil, founded, err
+// missing tells why a write to the auto with ifVersion affected no row
+func (ar *SQLAutomobilesRepository) missing(ctx context.Context, mark string, ifVersion int) error {
+	if ifVersion == 0 {
+		return notFound("auto %q", mark)
 	}
-	var automobileFinded *models.Automobiles
-	for _, a := range automobiles {
-		if a.Mark == mark {
-			automobileFinded = a
-			founded = true
-		}
+	query := fmt.Sprintf("SELECT version FROM %s WHERE mark=$1", tableAutomobiles)
+	var version int
+	if err := ar.store.db.QueryRowContext(ctx, query, mark).Scan(&version); err != nil {
+		return sqlError(err, "auto %q", mark)
 	}
+	return versionMismatch(version, "auto %q", mark)
+}
 
-	return automobileFinded, founded, nil
-
+//Helper for find by mark and GET request. Uses the unique index on mark
+func (ar *SQLAutomobilesRepository) FindAutomobileByMark(ctx context.Context, mark string) (*models.Automobiles, error) {
+	ctx, cancel := ar.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE mark=$1", columnsAutomobiles, tableAutomobiles)
+	a := models.Automobiles{}
+	err := ar.store.db.QueryRowContext(ctx, query, mark).Scan(&a.ID, &a.Mark, &a.Maxspeed, &a.Distance, &a.Handler, &a.Stock, &a.Version)
+	if err != nil {
+		return nil, sqlError(err, "auto %q", mark)
+	}
+	return &a, nil
 }
 
-//Get all request and helper for FindAutomobileByMark
-func (ar *AutomobilesRepository) SelectAll() ([]*models.Automobiles, error) {
-	query := fmt.Sprintf("SELECT * FROM %s", tableAutomobiles)
-	rows, err := ar.store.db.Query(query)
+//Get all request
+func (ar *SQLAutomobilesRepository) SelectAll(ctx context.Context) ([]*models.Automobiles, error) {
+	ctx, cancel := ar.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("SELECT %s FROM %s", columnsAutomobiles, tableAutomobiles)
+	rows, err := ar.store.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, sqlError(err, "autos")
 	}
 	defer rows.Close()
 	automobiles := make([]*models.Automobiles, 0)
 	for rows.Next() {
 		a := models.Automobiles{}
-		err := rows.Scan(&a.ID, &a.Mark, &a.Maxspeed, &a.Distance, &a.Handler, &a.Stock)
+		err := rows.Scan(&a.ID, &a.Mark, &a.Maxspeed, &a.Distance, &a.Handler, &a.Stock, &a.Version)
 		if err != nil {
 			log.Println(err)
 			continue
 		}
 		automobiles = append(automobiles, &a)
 	}
-	return automobiles, nil
+	return automobiles, sqlError(rows.Err(), "autos")
 }
 
-//For UPDATE request
-func (ar *AutomobilesRepository) UpdateByMark(mark string, newAuto *models.Automobiles) (*models.Automobiles, error) {
-	oldAuto, ok, err := ar.FindAutomobileByMark(mark)
+//Page of filtered and sorted autos for GET /stock. Filtering and ordering happen in SQL
+func (ar *SQLAutomobilesRepository) SelectPage(ctx context.Context, q *AutomobilesQuery) (*AutomobilesPage, error) {
+	ctx, cancel := ar.store.withTimeout(ctx)
+	defer cancel()
+	column, err := q.sortColumn()
 	if err != nil {
 		return nil, err
 	}
-	if ok {
-		query := fmt.Sprintf("update %s set maxspeed = $1, distance = $2, handler = $3, stock = $4 where mark=$5", tableAutomobiles)
-		_, err = ar.store.db.Exec(query, newAuto.Maxspeed, newAuto.Distance, newAuto.Handler, newAuto.Stock, mark)
-		if err != nil {
-			return nil, err
+	cursor, err := q.decodeCursor(column)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AutomobilesPage{}
+	b := &sqlBuilder{}
+	q.filter(b)
+	query := fmt.Sprintf("SELECT count(*) FROM %s%s", tableAutomobiles, b.whereClause())
+	if err := ar.store.db.QueryRowContext(ctx, query, b.args...).Scan(&page.Total); err != nil {
+		return nil, sqlError(err, "autos")
+	}
+
+	direction, compare := "ASC", ">"
+	if q.SortDesc {
+		direction, compare = "DESC", "<"
+	}
+	if cursor != nil {
+		var value interface{} = cursor.Value
+		if isIntColumn(column) {
+			value, _ = strconv.Atoi(cursor.Value)
+		}
+		if column == "id" {
+			b.where("id "+compare+" %s", cursor.ID)
+		} else {
+			b.where("("+sortExpression(column)+", id) "+compare+" (%s, %s)", value, cursor.ID)
 		}
 	}
-	newAuto.ID = oldAuto.ID
+	query = fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s", columnsAutomobiles, tableAutomobiles, b.whereClause(), sortExpression(column), direction)
+	if column != "id" {
+		query += ", id " + direction
+	}
+	if q.Limit > 0 {
+		query += " LIMIT " + b.arg(q.Limit)
+	}
+	if q.Offset > 0 {
+		query += " OFFSET " + b.arg(q.Offset)
+	}
 
+	rows, err := ar.store.db.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, sqlError(err, "autos")
+	}
+	defer rows.Close()
+	page.Automobiles = make([]*models.Automobiles, 0)
+	for rows.Next() {
+		a := models.Automobiles{}
+		if err := rows.Scan(&a.ID, &a.Mark, &a.Maxspeed, &a.Distance, &a.Handler, &a.Stock, &a.Version); err != nil {
+			return nil, sqlError(err, "autos")
+		}
+		page.Automobiles = append(page.Automobiles, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqlError(err, "autos")
+	}
+	if q.Limit > 0 && len(page.Automobiles) == q.Limit {
+		page.NextCursor = q.encodeCursor(column, page.Automobiles[len(page.Automobiles)-1])
+	}
+	return page, nil
+}
+
+//For UPDATE request. Renames the auto if newAuto.Mark is set and differs from mark, increments the version.
+//ErrNotFound if there is no auto with that mark, ErrConflict if the new mark is taken
+func (ar *SQLAutomobilesRepository) UpdateByMark(ctx context.Context, mark string, newAuto *models.Automobiles, ifVersion int) (*models.Automobiles, error) {
+	ctx, cancel := ar.store.withTimeout(ctx)
+	defer cancel()
+	if newAuto.Mark == "" {
+		newAuto.Mark = mark
+	}
+	b := &sqlBuilder{}
+	set := fmt.Sprintf("mark = %s, maxspeed = %s, distance = %s, handler = %s, stock = %s, version = version + 1",
+		b.arg(newAuto.Mark), b.arg(newAuto.Maxspeed), b.arg(newAuto.Distance), b.arg(newAuto.Handler), b.arg(newAuto.Stock))
+	b.where("mark=%s", mark)
+	if ifVersion != 0 {
+		b.where("version=%s", ifVersion)
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s%s RETURNING id, version", tableAutomobiles, set, b.whereClause())
+	err := ar.store.db.QueryRowContext(ctx, query, b.args...).Scan(&newAuto.ID, &newAuto.Version)
+	//No row returned means no row was affected
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ar.missing(ctx, mark, ifVersion)
+	}
+	if err != nil {
+		//A taken new mark violates the unique index
+		return nil, sqlError(err, "auto %q", newAuto.Mark)
+	}
 	return newAuto, nil
 }
+
+//For PATCH request. Sets only the columns of the patch and increments the version.
+//ErrNotFound if there is no auto with that mark, ErrConflict if a new mark is taken
+func (ar *SQLAutomobilesRepository) PatchByMark(ctx context.Context, mark string, patch *AutomobilePatch, ifVersion int) (*models.Automobiles, error) {
+	if patch.IsEmpty() {
+		a, err := ar.FindAutomobileByMark(ctx, mark)
+		if err == nil && ifVersion != 0 && a.Version != ifVersion {
+			return nil, versionMismatch(a.Version, "auto %q", mark)
+		}
+		return a, err
+	}
+	ctx, cancel := ar.store.withTimeout(ctx)
+	defer cancel()
+	b := &sqlBuilder{}
+	columns, values := patch.columns()
+	set := make([]string, len(columns))
+	for i, column := range columns {
+		set[i] = column + " = " + b.arg(values[i])
+	}
+	set = append(set, "version = version + 1")
+	b.where("mark=%s", mark)
+	if ifVersion != 0 {
+		b.where("version=%s", ifVersion)
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s%s RETURNING %s", tableAutomobiles, strings.Join(set, ", "), b.whereClause(), columnsAutomobiles)
+	a := models.Automobiles{}
+	err := ar.store.db.QueryRowContext(ctx, query, b.args...).Scan(&a.ID, &a.Mark, &a.Maxspeed, &a.Distance, &a.Handler, &a.Stock, &a.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ar.missing(ctx, mark, ifVersion)
+	}
+	if err != nil && patch.Mark != nil {
+		return nil, sqlError(err, "auto %q", *patch.Mark)
+	}
+	if err != nil {
+		return nil, sqlError(err, "auto %q", mark)
+	}
+	return &a, nil
+}
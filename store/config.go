@@ -1,10 +1,99 @@
 package store
 
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
 type Config struct {
+	// Driver selects the backend: "postgres" (default) or "memory"
+	Driver string `toml:"driver"`
 	//DatabaseURL ...
-	DatabaseURL string `toml:"database_url"`
+	DatabaseURL string `toml:"database_url" secret:"true"`
+	// Connection pool of database/sql, 0 means unlimited
+	MaxOpenConns    int           `toml:"max_open_conns"`
+	MaxIdleConns    int           `toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `toml:"conn_max_idle_time"`
+	// ConnectTimeout is how long Open retries to reach the database on start
+	ConnectTimeout time.Duration `toml:"connect_timeout"`
+	// QueryTimeout bounds every repository call unless the caller's context ends earlier, 0 means no limit
+	QueryTimeout time.Duration `toml:"query_timeout"`
 }
 
 func NewConfig() *Config {
-	return &Config{}
+	return &Config{
+		Driver:          DriverPostgres,
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		ConnectTimeout:  30 * time.Second,
+		QueryTimeout:    5 * time.Second,
+	}
+}
+
+// ConfigError lists every problem Validate found
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid store config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the config without connecting to the database
+func (c *Config) Validate() error {
+	var problems []string
+	switch c.Driver {
+	case DriverPostgres, "":
+		if c.DatabaseURL == "" {
+			problems = append(problems, "store.database_url is empty")
+		} else if _, err := pq.NewConnector(c.DatabaseURL); err != nil {
+			problems = append(problems, fmt.Sprintf("store.database_url can not be parsed: %s", err))
+		}
+	case DriverMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("store.driver %q is unknown, use %q or %q", c.Driver, DriverPostgres, DriverMemory))
+	}
+	problems = append(problems, c.validatePool()...)
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+func (c *Config) validatePool() []string {
+	var problems []string
+	for _, n := range []struct {
+		key   string
+		value int
+	}{
+		{"store.max_open_conns", c.MaxOpenConns},
+		{"store.max_idle_conns", c.MaxIdleConns},
+	} {
+		if n.value < 0 {
+			problems = append(problems, fmt.Sprintf("%s %d must not be negative", n.key, n.value))
+		}
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		problems = append(problems, fmt.Sprintf("store.max_idle_conns %d is greater than store.max_open_conns %d", c.MaxIdleConns, c.MaxOpenConns))
+	}
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"store.conn_max_lifetime", c.ConnMaxLifetime},
+		{"store.conn_max_idle_time", c.ConnMaxIdleTime},
+		{"store.connect_timeout", c.ConnectTimeout},
+		{"store.query_timeout", c.QueryTimeout},
+	} {
+		if d.value < 0 {
+			problems = append(problems, fmt.Sprintf("%s %s must not be negative", d.key, d.value))
+		}
+	}
+	return problems
 }
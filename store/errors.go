@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of store errors. Every driver reports failures with these, match them with errors.Is
+var (
+	// ErrNotFound - there is no row with that key
+	ErrNotFound = errors.New("not found")
+	// ErrConflict - a row with that unique key already exists
+	ErrConflict = errors.New("conflict")
+	// ErrVersionMismatch - the row was changed since the version the caller expected
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrUnavailable - the database can not be reached or did not answer in time
+	ErrUnavailable = errors.New("store unavailable")
+)
+
+// Error is a store failure of one of the kinds above.
+// Message is safe to show to clients, Err keeps the driver error for logs.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the kind of the error
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &Error{Kind: ErrNotFound, Message: fmt.Sprintf(format, args...) + " not found"}
+}
+
+func conflict(format string, args ...interface{}) error {
+	return &Error{Kind: ErrConflict, Message: fmt.Sprintf(format, args...) + " already exists"}
+}
+
+func versionMismatch(version int, format string, args ...interface{}) error {
+	return &Error{Kind: ErrVersionMismatch, Message: fmt.Sprintf(format, args...) + fmt.Sprintf(" has version %d", version)}
+}
+
+// Postgres error classes and codes that mean the database is unavailable
+const (
+	pqClassConnectionException = "08"
+	pqClassInsufficientRes     = "53"
+	pqCodeAdminShutdown        = "57P01"
+	pqCodeCannotConnectNow     = "57P03"
+	pqCodeUniqueViolation      = "23505"
+)
+
+// sqlError maps an error of database/sql to a store Error. The format and args name the row
+// for the message, e.g. `auto %q`. Errors of other kinds are returned as is.
+func sqlError(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(format, args...)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == pqCodeUniqueViolation:
+			return conflict(format, args...)
+		case pqErr.Code.Class() == pqClassConnectionException,
+			pqErr.Code.Class() == pqClassInsufficientRes,
+			pqErr.Code == pqCodeAdminShutdown,
+			pqErr.Code == pqCodeCannotConnectNow:
+			return &Error{Kind: ErrUnavailable, Message: "database is unavailable", Err: err}
+		}
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) || errors.As(err, &netErr) {
+		return &Error{Kind: ErrUnavailable, Message: "database is unavailable", Err: err}
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestSQLError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		kind    error
+		message string
+	}{
+		{"no rows", sql.ErrNoRows, ErrNotFound, `auto "bmw" not found`},
+		{"unique violation", &pq.Error{Code: "23505"}, ErrConflict, `auto "bmw" already exists`},
+		{"connection exception", &pq.Error{Code: "08006"}, ErrUnavailable, "database is unavailable"},
+		{"cannot connect now", &pq.Error{Code: "57P03"}, ErrUnavailable, "database is unavailable"},
+		{"timeout", fmt.Errorf("query: %w", context.DeadlineExceeded), ErrUnavailable, "database is unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sqlError(tt.err, "auto %q", "bmw")
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("got %v, want kind %v", err, tt.kind)
+			}
+			var storeErr *Error
+			if !errors.As(err, &storeErr) || storeErr.Message != tt.message {
+				t.Fatalf("got message %q, want %q", storeErr.Message, tt.message)
+			}
+		})
+	}
+
+	other := &pq.Error{Code: "42P01"}
+	if err := sqlError(other, "auto %q", "bmw"); err != other {
+		t.Fatalf("other errors are returned as is, got %v", err)
+	}
+	if err := sqlError(nil, "auto %q", "bmw"); err != nil {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// QueryHook is called before every repository call with the repository and method names,
+// e.g. "automobiles", "FindAutomobileByMark". The returned context is passed to the call,
+// done is called with its error once it returns.
+type QueryHook func(ctx context.Context, repository string, operation string) (_ context.Context, done func(err error))
+
+// AddQueryHook makes every repository call run through h. Hooks must be added before the store is used.
+func (s *Store) AddQueryHook(h QueryHook) {
+	s.hooks = append(s.hooks, h)
+}
+
+// observe runs the hooks for one repository call
+func (s *Store) observe(ctx context.Context, repository string, operation string) (context.Context, func(err error)) {
+	if len(s.hooks) == 0 {
+		return ctx, func(error) {}
+	}
+	dones := make([]func(error), len(s.hooks))
+	for i, h := range s.hooks {
+		ctx, dones[i] = h(ctx, repository, operation)
+	}
+	return ctx, func(err error) {
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](err)
+		}
+	}
+}
+
+// Repository names passed to hooks
+const (
+	RepositoryAutomobiles     = "automobiles"
+	RepositoryUsersauto       = "usersauto"
+	RepositoryRefreshTokens   = "refresh_tokens"
+	RepositoryRevokedTokens   = "revoked_tokens"
+	RepositoryIdempotencyKeys = "idempotency_keys"
+	RepositoryLoginAttempts   = "login_attempts"
+)
+
+// Repositories below run every call of the driver repository through the hooks of the store
+
+type observedAutomobiles struct {
+	store *Store
+	next  AutomobilesRepository
+}
+
+func (o *observedAutomobiles) Create(ctx context.Context, a *models.Automobiles) (_ *models.Automobiles, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryAutomobiles, "Create")
+	defer func() { done(err) }()
+	return o.next.Create(ctx, a)
+}
+
+func (o *observedAutomobiles) DeleteByMark(ctx context.Context, mark string, ifVersion int) (err error) {
+	ctx, done := o.store.observe(ctx, RepositoryAutomobiles, "DeleteByMark")
+	defer func() { done(err) }()
+	return o.next.DeleteByMark(ctx, mark, ifVersion)
+}
+
+func (o *observedAutomobiles) FindAutomobileByMark(ctx context.Context, mark string) (_ *models.Automobiles, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryAutomobiles, "FindAutomobileByMark")
+	defer func() { done(err) }()
+	return o.next.FindAutomobileByMark(ctx, mark)
+}
+
+func (o *observedAutomobiles) PatchByMark(ctx context.Context, mark string, patch *AutomobilePatch, ifVersion int) (_ *models.Automobiles, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryAutomobiles, "PatchByMark")
+	defer func() { done(err) }()
+	return o.next.PatchByMark(ctx, mark, patch, ifVersion)
+}
+
+func (o *observedAutomobiles) SelectAll(ctx context.Context) (_ []*models.Automobiles, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryAutomobiles, "SelectAll")
+	defer func() { done(err) }()
+	return o.next.SelectAll(ctx)
+}
+
+func (o *observedAutomobiles) SelectPage(ctx context.Context, q *AutomobilesQuery) (_ *AutomobilesPage, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryAutomobiles, "SelectPage")
+	defer func() { done(err) }()
+	return o.next.SelectPage(ctx, q)
+}
+
+func (o *observedAutomobiles) UpdateByMark(ctx context.Context, mark string, newAuto *models.Automobiles, ifVersion int) (_ *models.Automobiles, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryAutomobiles, "UpdateByMark")
+	defer func() { done(err) }()
+	return o.next.UpdateByMark(ctx, mark, newAuto, ifVersion)
+}
+
+type observedUsersauto struct {
+	store *Store
+	next  UsersautoRepository
+}
+
+func (o *observedUsersauto) Create(ctx context.Context, u *models.Usersauto) (_ *models.Usersauto, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryUsersauto, "Create")
+	defer func() { done(err) }()
+	return o.next.Create(ctx, u)
+}
+
+func (o *observedUsersauto) FindByUsername(ctx context.Context, username string) (_ *models.Usersauto, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryUsersauto, "FindByUsername")
+	defer func() { done(err) }()
+	return o.next.FindByUsername(ctx, username)
+}
+
+func (o *observedUsersauto) UpdatePassword(ctx context.Context, u *models.Usersauto) (err error) {
+	ctx, done := o.store.observe(ctx, RepositoryUsersauto, "UpdatePassword")
+	defer func() { done(err) }()
+	return o.next.UpdatePassword(ctx, u)
+}
+
+func (o *observedUsersauto) UpdateRole(ctx context.Context, username string, role string) (err error) {
+	ctx, done := o.store.observe(ctx, RepositoryUsersauto, "UpdateRole")
+	defer func() { done(err) }()
+	return o.next.UpdateRole(ctx, username, role)
+}
+
+func (o *observedUsersauto) SelectAll(ctx context.Context) (_ []*models.Usersauto, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryUsersauto, "SelectAll")
+	defer func() { done(err) }()
+	return o.next.SelectAll(ctx)
+}
+
+type observedRefreshTokens struct {
+	store *Store
+	next  RefreshTokensRepository
+}
+
+func (o *observedRefreshTokens) Create(ctx context.Context, t *models.RefreshToken) (_ *models.RefreshToken, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryRefreshTokens, "Create")
+	defer func() { done(err) }()
+	return o.next.Create(ctx, t)
+}
+
+func (o *observedRefreshTokens) FindByHash(ctx context.Context, tokenHash string) (_ *models.RefreshToken, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryRefreshTokens, "FindByHash")
+	defer func() { done(err) }()
+	return o.next.FindByHash(ctx, tokenHash)
+}
+
+func (o *observedRefreshTokens) Use(ctx context.Context, tokenHash string, now time.Time) (_ *models.RefreshToken, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryRefreshTokens, "Use")
+	defer func() { done(err) }()
+	return o.next.Use(ctx, tokenHash, now)
+}
+
+func (o *observedRefreshTokens) RevokeByUsername(ctx context.Context, username string, now time.Time) (err error) {
+	ctx, done := o.store.observe(ctx, RepositoryRefreshTokens, "RevokeByUsername")
+	defer func() { done(err) }()
+	return o.next.RevokeByUsername(ctx, username, now)
+}
+
+type observedRevokedTokens struct {
+	store *Store
+	next  RevokedTokensRepository
+}
+
+func (o *observedRevokedTokens) Revoke(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	ctx, done := o.store.observe(ctx, RepositoryRevokedTokens, "Revoke")
+	defer func() { done(err) }()
+	return o.next.Revoke(ctx, jti, expiresAt)
+}
+
+func (o *observedRevokedTokens) IsRevoked(ctx context.Context, jti string) (_ bool, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryRevokedTokens, "IsRevoked")
+	defer func() { done(err) }()
+	return o.next.IsRevoked(ctx, jti)
+}
+
+type observedIdempotencyKeys struct {
+	store *Store
+	next  IdempotencyKeysRepository
+}
+
+func (o *observedIdempotencyKeys) Start(ctx context.Context, k *models.IdempotencyKey, now time.Time) (_ *models.IdempotencyKey, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryIdempotencyKeys, "Start")
+	defer func() { done(err) }()
+	return o.next.Start(ctx, k, now)
+}
+
+func (o *observedIdempotencyKeys) Complete(ctx context.Context, k *models.IdempotencyKey) (err error) {
+	ctx, done := o.store.observe(ctx, RepositoryIdempotencyKeys, "Complete")
+	defer func() { done(err) }()
+	return o.next.Complete(ctx, k)
+}
+
+func (o *observedIdempotencyKeys) Delete(ctx context.Context, scope string, key string) (err error) {
+	ctx, done := o.store.observe(ctx, RepositoryIdempotencyKeys, "Delete")
+	defer func() { done(err) }()
+	return o.next.Delete(ctx, scope, key)
+}
+
+type observedLoginAttempts struct {
+	store *Store
+	next  LoginAttemptsRepository
+}
+
+func (o *observedLoginAttempts) Create(ctx context.Context, a *models.LoginAttempt) (_ *models.LoginAttempt, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryLoginAttempts, "Create")
+	defer func() { done(err) }()
+	return o.next.Create(ctx, a)
+}
+
+func (o *observedLoginAttempts) Start(ctx context.Context, a *models.LoginAttempt, maxFailures int, since time.Time) (_ time.Time, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryLoginAttempts, "Start")
+	defer func() { done(err) }()
+	return o.next.Start(ctx, a, maxFailures, since)
+}
+
+func (o *observedLoginAttempts) Finish(ctx context.Context, a *models.LoginAttempt) (err error) {
+	ctx, done := o.store.observe(ctx, RepositoryLoginAttempts, "Finish")
+	defer func() { done(err) }()
+	return o.next.Finish(ctx, a)
+}
+
+func (o *observedLoginAttempts) Select(ctx context.Context, q *LoginAttemptsQuery) (_ []*models.LoginAttempt, err error) {
+	ctx, done := o.store.observe(ctx, RepositoryLoginAttempts, "Select")
+	defer func() { done(err) }()
+	return o.next.Select(ctx, q)
+}
+
+// observeRepositories wraps the driver repositories, called once by Open
+func (s *Store) observeRepositories() {
+	s.automobilesRepository = &observedAutomobiles{store: s, next: s.automobilesRepository}
+	s.usersautoRepository = &observedUsersauto{store: s, next: s.usersautoRepository}
+	s.refreshTokens = &observedRefreshTokens{store: s, next: s.refreshTokens}
+	s.revokedTokens = &observedRevokedTokens{store: s, next: s.revokedTokens}
+	s.idempotencyKeys = &observedIdempotencyKeys{store: s, next: s.idempotencyKeys}
+	s.loginAttempts = &observedLoginAttempts{store: s, next: s.loginAttempts}
+}
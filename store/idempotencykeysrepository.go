@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// SQLIdempotencyKeysRepository is IdempotencyKeysRepository backed by postgres
+type SQLIdempotencyKeysRepository struct {
+	store *Store
+}
+
+var (
+	tableIdempotencyKeys   string = "idempotency_keys"
+	columnsIdempotencyKeys string = "scope, key, request_hash, status_code, response_header, response_body, created_at, expires_at"
+)
+
+// Reserve the key for a new request. Expired keys are dropped on the way.
+// If the key is taken, the stored one is returned together with ErrConflict
+func (ir *SQLIdempotencyKeysRepository) Start(ctx context.Context, k *models.IdempotencyKey, now time.Time) (*models.IdempotencyKey, error) {
+	ctx, cancel := ir.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("DELETE FROM %s WHERE expires_at <= $1", tableIdempotencyKeys)
+	if _, err := ir.store.db.ExecContext(ctx, query, now); err != nil {
+		return nil, sqlError(err, "idempotency keys")
+	}
+	query = fmt.Sprintf("INSERT INTO %s (scope, key, request_hash, created_at, expires_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (scope, key) DO NOTHING", tableIdempotencyKeys)
+	res, err := ir.store.db.ExecContext(ctx, query, k.Scope, k.Key, k.RequestHash, now, k.ExpiresAt)
+	if err != nil {
+		return nil, sqlError(err, "idempotency key %q", k.Key)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, sqlError(err, "idempotency key %q", k.Key)
+	}
+	if affected > 0 {
+		k.CreatedAt = now
+		return k, nil
+	}
+
+	query = fmt.Sprintf("SELECT %s FROM %s WHERE scope=$1 AND key=$2", columnsIdempotencyKeys, tableIdempotencyKeys)
+	stored := models.IdempotencyKey{}
+	var statusCode sql.NullInt64
+	var header []byte
+	err = ir.store.db.QueryRowContext(ctx, query, k.Scope, k.Key).Scan(
+		&stored.Scope, &stored.Key, &stored.RequestHash, &statusCode, &header, &stored.ResponseBody, &stored.CreatedAt, &stored.ExpiresAt)
+	if err != nil {
+		//The key expired and was deleted in between, the client may simply retry
+		return nil, sqlError(err, "idempotency key %q", k.Key)
+	}
+	stored.StatusCode = int(statusCode.Int64)
+	if len(header) > 0 {
+		if err := json.Unmarshal(header, &stored.ResponseHeader); err != nil {
+			return nil, err
+		}
+	}
+	return &stored, conflict("idempotency key %q", k.Key)
+}
+
+// Save the response of the request that reserved the key, the key is kept until k.ExpiresAt
+func (ir *SQLIdempotencyKeysRepository) Complete(ctx context.Context, k *models.IdempotencyKey) error {
+	ctx, cancel := ir.store.withTimeout(ctx)
+	defer cancel()
+	header, err := json.Marshal(k.ResponseHeader)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("UPDATE %s SET status_code = $3, response_header = $4, response_body = $5, expires_at = $6 WHERE scope=$1 AND key=$2", tableIdempotencyKeys)
+	_, err = ir.store.db.ExecContext(ctx, query, k.Scope, k.Key, k.StatusCode, header, k.ResponseBody, k.ExpiresAt)
+	return sqlError(err, "idempotency key %q", k.Key)
+}
+
+// Release the key, e.g. after the request failed, so a retry runs again
+func (ir *SQLIdempotencyKeysRepository) Delete(ctx context.Context, scope string, key string) error {
+	ctx, cancel := ir.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("DELETE FROM %s WHERE scope=$1 AND key=$2", tableIdempotencyKeys)
+	_, err := ir.store.db.ExecContext(ctx, query, scope, key)
+	return sqlError(err, "idempotency key %q", key)
+}
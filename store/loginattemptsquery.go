@@ -0,0 +1,49 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// LoginAttemptsQuery describes which attempts LoginAttemptsRepository.Select returns, newest first.
+// Zero values mean "no restriction"; Limit 0 returns every matching row.
+type LoginAttemptsQuery struct {
+	Limit  int
+	Offset int
+
+	Username string
+	IP       string
+	Outcome  string
+	// Since and Until bound created_at, inclusive
+	Since time.Time
+	Until time.Time
+}
+
+// filter adds the filtering part of the query
+func (q *LoginAttemptsQuery) filter(b *sqlBuilder) {
+	if q.Username != "" {
+		b.where("username = %s", q.Username)
+	}
+	if q.IP != "" {
+		b.where("ip = %s", q.IP)
+	}
+	if q.Outcome != "" {
+		b.where("outcome = %s", q.Outcome)
+	}
+	if !q.Since.IsZero() {
+		b.where("created_at >= %s", q.Since)
+	}
+	if !q.Until.IsZero() {
+		b.where("created_at <= %s", q.Until)
+	}
+}
+
+// matches is filter for the memory driver
+func (q *LoginAttemptsQuery) matches(a *models.LoginAttempt) bool {
+	return (q.Username == "" || a.Username == q.Username) &&
+		(q.IP == "" || a.IP == q.IP) &&
+		(q.Outcome == "" || a.Outcome == q.Outcome) &&
+		(q.Since.IsZero() || !a.CreatedAt.Before(q.Since)) &&
+		(q.Until.IsZero() || !a.CreatedAt.After(q.Until))
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// SQLLoginAttemptsRepository is LoginAttemptsRepository backed by postgres
+type SQLLoginAttemptsRepository struct {
+	store *Store
+}
+
+var (
+	tableLoginAttempts   string = "login_attempts"
+	columnsLoginAttempts string = "id, username, ip, user_agent, outcome, created_at"
+)
+
+// Save an attempt
+func (lr *SQLLoginAttemptsRepository) Create(ctx context.Context, a *models.LoginAttempt) (*models.LoginAttempt, error) {
+	ctx, cancel := lr.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("INSERT INTO %s (username, ip, user_agent, outcome) VALUES ($1, $2, $3, $4) RETURNING id, created_at", tableLoginAttempts)
+	if err := lr.store.db.QueryRowContext(ctx, query, a.Username, a.IP, a.UserAgent, a.Outcome).Scan(&a.ID, &a.CreatedAt); err != nil {
+		return nil, sqlError(err, "login attempt")
+	}
+	return a, nil
+}
+
+// Record a.Username starting to log in from a.IP, before its password is checked. If the username
+// has maxFailures failed or pending attempts from a.IP after since and after its last successful
+// login from a.IP, the attempt is recorded as LoginLocked, else as LoginPending until Finish.
+// last is the time of the latest failure. The count and the insert hold a lock on the IP and
+// username, so parallel attempts see each other. maxFailures 0 never locks
+func (lr *SQLLoginAttemptsRepository) Start(ctx context.Context, a *models.LoginAttempt, maxFailures int, since time.Time) (time.Time, error) {
+	ctx, cancel := lr.store.withTimeout(ctx)
+	defer cancel()
+	tx, err := lr.store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, sqlError(err, "login attempts")
+	}
+	defer tx.Rollback()
+	//The lock is released on commit. Statements after it see attempts committed while waiting
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", tableLoginAttempts+":"+a.IP+":"+a.Username); err != nil {
+		return time.Time{}, sqlError(err, "login attempts")
+	}
+	query := fmt.Sprintf(`SELECT count(*), max(created_at) FROM %[1]s
+		WHERE username=$1 AND ip=$2 AND outcome IN ($4, $5, $6) AND created_at > $3
+		AND created_at > coalesce((SELECT max(created_at) FROM %[1]s WHERE username=$1 AND ip=$2 AND outcome=$7), '-infinity')`, tableLoginAttempts)
+	var count int
+	var last sql.NullTime
+	err = tx.QueryRowContext(ctx, query, a.Username, a.IP, since,
+		models.LoginBadPassword, models.LoginUnknownUser, models.LoginPending, models.LoginSucceeded).Scan(&count, &last)
+	if err != nil {
+		return time.Time{}, sqlError(err, "login attempts")
+	}
+	a.Outcome = models.LoginPending
+	if maxFailures > 0 && count >= maxFailures {
+		a.Outcome = models.LoginLocked
+	}
+	query = fmt.Sprintf("INSERT INTO %s (username, ip, user_agent, outcome) VALUES ($1, $2, $3, $4) RETURNING id, created_at", tableLoginAttempts)
+	if err := tx.QueryRowContext(ctx, query, a.Username, a.IP, a.UserAgent, a.Outcome).Scan(&a.ID, &a.CreatedAt); err != nil {
+		return time.Time{}, sqlError(err, "login attempt")
+	}
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, sqlError(err, "login attempt")
+	}
+	return last.Time, nil
+}
+
+// Set the outcome of an attempt recorded by Start
+func (lr *SQLLoginAttemptsRepository) Finish(ctx context.Context, a *models.LoginAttempt) error {
+	ctx, cancel := lr.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("UPDATE %s SET outcome = $2 WHERE id = $1", tableLoginAttempts)
+	_, err := lr.store.db.ExecContext(ctx, query, a.ID, a.Outcome)
+	return sqlError(err, "login attempt")
+}
+
+// Attempts matching q, newest first
+func (lr *SQLLoginAttemptsRepository) Select(ctx context.Context, q *LoginAttemptsQuery) ([]*models.LoginAttempt, error) {
+	ctx, cancel := lr.store.withTimeout(ctx)
+	defer cancel()
+	b := &sqlBuilder{}
+	q.filter(b)
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY created_at DESC, id DESC", columnsLoginAttempts, tableLoginAttempts, b.whereClause())
+	if q.Limit > 0 {
+		query += " LIMIT " + b.arg(q.Limit)
+	}
+	if q.Offset > 0 {
+		query += " OFFSET " + b.arg(q.Offset)
+	}
+	rows, err := lr.store.db.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, sqlError(err, "login attempts")
+	}
+	defer rows.Close()
+	attempts := make([]*models.LoginAttempt, 0)
+	for rows.Next() {
+		a := models.LoginAttempt{}
+		if err := rows.Scan(&a.ID, &a.Username, &a.IP, &a.UserAgent, &a.Outcome, &a.CreatedAt); err != nil {
+			return nil, sqlError(err, "login attempts")
+		}
+		attempts = append(attempts, &a)
+	}
+	return attempts, sqlError(rows.Err(), "login attempts")
+}
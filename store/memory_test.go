@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+func TestMemoryUsersauto(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUsersautoRepository()
+	if _, err := users.Create(ctx, &models.Usersauto{Username: "alice", Password: "password1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Create(ctx, &models.Usersauto{Username: "alice", Password: "password2"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("duplicate username: got %v", err)
+	}
+	u, err := users.FindByUsername(ctx, "alice")
+	if err != nil || !u.ComparePassword("password1") {
+		t.Fatalf("got %v, %v", u, err)
+	}
+	if _, err := users.FindByUsername(ctx, "bob"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing user: got %v", err)
+	}
+	if err := users.UpdateRole(ctx, "bob", models.RoleAdmin); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("role of missing user: got %v", err)
+	}
+	//Stored values are copies
+	u.Password = "changed"
+	if again, _ := users.FindByUsername(ctx, "alice"); !again.ComparePassword("password1") {
+		t.Fatal("stored user was changed through a returned value")
+	}
+}
+
+func TestMemoryAutomobiles(t *testing.T) {
+	ctx := context.Background()
+	autos := NewMemoryAutomobilesRepository()
+	for _, mark := range []string{"bmw", "audi", "kia"} {
+		if _, err := autos.Create(ctx, &models.Automobiles{Mark: mark, Maxspeed: 200}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := autos.Create(ctx, &models.Automobiles{Mark: "bmw"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("duplicate mark: got %v", err)
+	}
+
+	all, err := autos.SelectAll(ctx)
+	if err != nil || len(all) != 3 || all[0].Mark != "bmw" || all[2].Mark != "kia" {
+		t.Fatalf("SelectAll is not ordered by id: %v, %v", all, err)
+	}
+
+	a, err := autos.UpdateByMark(ctx, "audi", &models.Automobiles{Maxspeed: 260}, 0)
+	if err != nil || a.ID != 2 || a.Mark != "audi" {
+		t.Fatalf("got %v, %v", a, err)
+	}
+	if _, err := autos.UpdateByMark(ctx, "lada", &models.Automobiles{}, 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("update of missing automobile: got %v", err)
+	}
+	if found, _ := autos.FindAutomobileByMark(ctx, "audi"); found.Maxspeed != 260 {
+		t.Fatalf("update was not stored: %v", found)
+	}
+
+	if err := autos.DeleteByMark(ctx, "bmw", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := autos.DeleteByMark(ctx, "bmw", 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("delete of missing automobile: got %v", err)
+	}
+	if _, err := autos.FindAutomobileByMark(ctx, "bmw"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted automobile: got %v", err)
+	}
+}
+
+func TestMemoryAutomobilesVersion(t *testing.T) {
+	ctx := context.Background()
+	autos := NewMemoryAutomobilesRepository()
+	a, err := autos.Create(ctx, &models.Automobiles{Mark: "bmw", Maxspeed: 200})
+	if err != nil || a.Version != 1 {
+		t.Fatalf("got %v, %v", a, err)
+	}
+	if a, err = autos.UpdateByMark(ctx, "bmw", &models.Automobiles{Maxspeed: 210}, 1); err != nil || a.Version != 2 {
+		t.Fatalf("got %v, %v", a, err)
+	}
+	if _, err := autos.UpdateByMark(ctx, "bmw", &models.Automobiles{Maxspeed: 220}, 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("update of stale version: got %v", err)
+	}
+	maxspeed := 230
+	if a, err = autos.PatchByMark(ctx, "bmw", &AutomobilePatch{Maxspeed: &maxspeed}, 2); err != nil || a.Version != 3 {
+		t.Fatalf("got %v, %v", a, err)
+	}
+	if a, err = autos.PatchByMark(ctx, "bmw", &AutomobilePatch{}, 0); err != nil || a.Version != 3 {
+		t.Fatalf("empty patch changed the version: %v, %v", a, err)
+	}
+	if err := autos.DeleteByMark(ctx, "bmw", 2); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("delete of stale version: got %v", err)
+	}
+	if err := autos.DeleteByMark(ctx, "bmw", 3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tests := []struct {
+		name string
+		// stored is in the repository before Start, nil for an empty one
+		stored *models.IdempotencyKey
+		want   error
+	}{
+		{"free key", nil, nil},
+		{"in progress", &models.IdempotencyKey{ExpiresAt: now.Add(time.Minute)}, ErrConflict},
+		{"expired lease is reclaimed", &models.IdempotencyKey{ExpiresAt: now.Add(-time.Second)}, nil},
+		{"completed", &models.IdempotencyKey{StatusCode: http.StatusCreated, ExpiresAt: now.Add(time.Hour)}, ErrConflict},
+		{"completed and expired", &models.IdempotencyKey{StatusCode: http.StatusCreated, ExpiresAt: now.Add(-time.Second)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := NewMemoryIdempotencyKeysRepository()
+			if tt.stored != nil {
+				tt.stored.Scope, tt.stored.Key = "alice", "k1"
+				keys.keys[[2]string{"alice", "k1"}] = tt.stored
+			}
+			k := &models.IdempotencyKey{Scope: "alice", Key: "k1", ExpiresAt: now.Add(time.Minute)}
+			stored, err := keys.Start(ctx, k, now)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && stored.Completed() {
+				t.Fatal("reserved key is completed")
+			}
+		})
+	}
+}
+
+func TestMemoryLoginAttemptsLockout(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		outcomes []string
+		max      int
+		want     string
+	}{
+		{"no attempts", nil, 3, models.LoginPending},
+		{"below the limit", []string{models.LoginBadPassword, models.LoginUnknownUser}, 3, models.LoginPending},
+		{"other ip at the limit", nil, 1, models.LoginPending},
+		{"at the limit", []string{models.LoginBadPassword, models.LoginBadPassword, models.LoginBadPassword}, 3, models.LoginLocked},
+		{"pending attempts count", []string{models.LoginPending, models.LoginPending, models.LoginPending}, 3, models.LoginLocked},
+		{"success resets", []string{models.LoginBadPassword, models.LoginBadPassword, models.LoginSucceeded, models.LoginBadPassword}, 3, models.LoginPending},
+		{"locked and malformed do not count", []string{models.LoginLocked, models.LoginMalformed, models.LoginBadPassword}, 2, models.LoginPending},
+		{"lockout off", []string{models.LoginBadPassword, models.LoginBadPassword, models.LoginBadPassword}, 0, models.LoginPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := NewMemoryLoginAttemptsRepository()
+			for _, outcome := range tt.outcomes {
+				attempts.Create(ctx, &models.LoginAttempt{Username: "alice", IP: "10.0.0.1", Outcome: outcome})
+			}
+			//Attempts of other users and from other IPs never count
+			attempts.Create(ctx, &models.LoginAttempt{Username: "bob", IP: "10.0.0.1", Outcome: models.LoginBadPassword})
+			attempts.Create(ctx, &models.LoginAttempt{Username: "alice", IP: "10.0.0.2", Outcome: models.LoginBadPassword})
+			a := &models.LoginAttempt{Username: "alice", IP: "10.0.0.1"}
+			if _, err := attempts.Start(ctx, a, tt.max, time.Now().Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if a.Outcome != tt.want {
+				t.Fatalf("got %s, want %s", a.Outcome, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryLoginAttemptsSelect(t *testing.T) {
+	ctx := context.Background()
+	attempts := NewMemoryLoginAttemptsRepository()
+	for _, a := range []*models.LoginAttempt{
+		{Username: "alice", IP: "10.0.0.1", Outcome: models.LoginBadPassword},
+		{Username: "alice", IP: "10.0.0.2", Outcome: models.LoginSucceeded},
+		{Username: "bob", IP: "10.0.0.1", Outcome: models.LoginUnknownUser},
+	} {
+		attempts.Create(ctx, a)
+	}
+	tests := []struct {
+		name string
+		q    LoginAttemptsQuery
+		want []int64
+	}{
+		{"all, newest first", LoginAttemptsQuery{}, []int64{3, 2, 1}},
+		{"by username", LoginAttemptsQuery{Username: "alice"}, []int64{2, 1}},
+		{"by ip", LoginAttemptsQuery{IP: "10.0.0.1"}, []int64{3, 1}},
+		{"by outcome", LoginAttemptsQuery{Outcome: models.LoginSucceeded}, []int64{2}},
+		{"limit and offset", LoginAttemptsQuery{Limit: 1, Offset: 1}, []int64{2}},
+		{"until before all", LoginAttemptsQuery{Until: time.Now().Add(-time.Hour)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := attempts.Select(ctx, &tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d attempts, want %d", len(got), len(tt.want))
+			}
+			for i, a := range got {
+				if a.ID != tt.want[i] {
+					t.Fatalf("attempt %d is %d, want %d", i, a.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryLoginAttemptsSince(t *testing.T) {
+	ctx := context.Background()
+	attempts := NewMemoryLoginAttemptsRepository()
+	attempts.Create(ctx, &models.LoginAttempt{Username: "alice", IP: "10.0.0.1", Outcome: models.LoginBadPassword})
+	since := time.Now()
+	a := &models.LoginAttempt{Username: "alice", IP: "10.0.0.1"}
+	if _, err := attempts.Start(ctx, a, 1, since); err != nil {
+		t.Fatal(err)
+	}
+	if a.Outcome != models.LoginPending {
+		t.Fatalf("failure before since: got %s", a.Outcome)
+	}
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// MemoryAutomobilesRepository is AutomobilesRepository kept in process memory.
+// Safe for concurrent use. Stored values are copied in and out, so callers never share them.
+type MemoryAutomobilesRepository struct {
+	mu          sync.RWMutex
+	lastID      int
+	automobiles map[string]*models.Automobiles
+}
+
+// Constructor for MemoryAutomobilesRepository
+func NewMemoryAutomobilesRepository() *MemoryAutomobilesRepository {
+	return &MemoryAutomobilesRepository{
+		automobiles: make(map[string]*models.Automobiles),
+	}
+}
+
+// For Post request
+func (ar *MemoryAutomobilesRepository) Create(ctx context.Context, a *models.Automobiles) (*models.Automobiles, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if _, ok := ar.automobiles[a.Mark]; ok {
+		return nil, conflict("auto %q", a.Mark)
+	}
+	ar.lastID++
+	a.ID = ar.lastID
+	a.Version = 1
+	stored := *a
+	ar.automobiles[a.Mark] = &stored
+	return a, nil
+}
+
+// For DELETE request. ErrNotFound if there is no auto with that mark
+func (ar *MemoryAutomobilesRepository) DeleteByMark(ctx context.Context, mark string, ifVersion int) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if _, err := ar.find(mark, ifVersion); err != nil {
+		return err
+	}
+	delete(ar.automobiles, mark)
+	return nil
+}
+
+// Helper for find by mark and GET request
+func (ar *MemoryAutomobilesRepository) FindAutomobileByMark(ctx context.Context, mark string) (*models.Automobiles, error) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	a, ok := ar.automobiles[mark]
+	if !ok {
+		return nil, notFound("auto %q", mark)
+	}
+	found := *a
+	return &found, nil
+}
+
+// Get all request, ordered by id like the rows of a fresh table
+func (ar *MemoryAutomobilesRepository) SelectAll(ctx context.Context) ([]*models.Automobiles, error) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	automobiles := make([]*models.Automobiles, 0, len(ar.automobiles))
+	for _, a := range ar.automobiles {
+		found := *a
+		automobiles = append(automobiles, &found)
+	}
+	sort.Slice(automobiles, func(i, j int) bool { return automobiles[i].ID < automobiles[j].ID })
+	return automobiles, nil
+}
+
+// Page of filtered and sorted autos for GET /stock
+func (ar *MemoryAutomobilesRepository) SelectPage(ctx context.Context, q *AutomobilesQuery) (*AutomobilesPage, error) {
+	column, err := q.sortColumn()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := q.decodeCursor(column)
+	if err != nil {
+		return nil, err
+	}
+	ar.mu.RLock()
+	matched := make([]*models.Automobiles, 0)
+	for _, a := range ar.automobiles {
+		if q.matches(a) {
+			found := *a
+			matched = append(matched, &found)
+		}
+	}
+	ar.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		c := compareAutomobiles(matched[i], matched[j], column)
+		if q.SortDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+	page := &AutomobilesPage{Total: len(matched)}
+	rest := matched
+	if cursor != nil {
+		last := &models.Automobiles{ID: cursor.ID}
+		setAutomobileColumnValue(last, column, cursor.Value)
+		rest = rest[sort.Search(len(rest), func(i int) bool {
+			c := compareAutomobiles(rest[i], last, column)
+			if q.SortDesc {
+				return c < 0
+			}
+			return c > 0
+		}):]
+	}
+	if q.Offset >= len(rest) {
+		rest = rest[:0]
+	} else {
+		rest = rest[q.Offset:]
+	}
+	if q.Limit > 0 && len(rest) > q.Limit {
+		rest = rest[:q.Limit]
+	}
+	page.Automobiles = rest
+	if q.Limit > 0 && len(rest) == q.Limit {
+		page.NextCursor = q.encodeCursor(column, rest[len(rest)-1])
+	}
+	return page, nil
+}
+
+// For UPDATE request. Renames the auto if newAuto.Mark is set and differs from mark, increments the version.
+// ErrNotFound if there is no auto with that mark, ErrConflict if the new mark is taken
+func (ar *MemoryAutomobilesRepository) UpdateByMark(ctx context.Context, mark string, newAuto *models.Automobiles, ifVersion int) (*models.Automobiles, error) {
+	if newAuto.Mark == "" {
+		newAuto.Mark = mark
+	}
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	oldAuto, err := ar.find(mark, ifVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := ar.rename(oldAuto, newAuto.Mark); err != nil {
+		return nil, err
+	}
+	oldAuto.Maxspeed = newAuto.Maxspeed
+	oldAuto.Distance = newAuto.Distance
+	oldAuto.Handler = newAuto.Handler
+	oldAuto.Stock = newAuto.Stock
+	oldAuto.Version++
+	newAuto.ID = oldAuto.ID
+	newAuto.Version = oldAuto.Version
+	return newAuto, nil
+}
+
+// For PATCH request. Sets only the fields of the patch and increments the version.
+// ErrNotFound if there is no auto with that mark, ErrConflict if a new mark is taken
+func (ar *MemoryAutomobilesRepository) PatchByMark(ctx context.Context, mark string, patch *AutomobilePatch, ifVersion int) (*models.Automobiles, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	a, err := ar.find(mark, ifVersion)
+	if err != nil {
+		return nil, err
+	}
+	if patch.IsEmpty() {
+		found := *a
+		return &found, nil
+	}
+	if patch.Mark != nil {
+		if err := ar.rename(a, *patch.Mark); err != nil {
+			return nil, err
+		}
+	}
+	patch.apply(a)
+	a.Version++
+	found := *a
+	return &found, nil
+}
+
+// find the auto to write at ifVersion, the caller holds the write lock
+func (ar *MemoryAutomobilesRepository) find(mark string, ifVersion int) (*models.Automobiles, error) {
+	a, ok := ar.automobiles[mark]
+	if !ok {
+		return nil, notFound("auto %q", mark)
+	}
+	if ifVersion != 0 && a.Version != ifVersion {
+		return nil, versionMismatch(a.Version, "auto %q", mark)
+	}
+	return a, nil
+}
+
+// rename moves a to the new mark, the caller holds the write lock
+func (ar *MemoryAutomobilesRepository) rename(a *models.Automobiles, mark string) error {
+	if mark == a.Mark {
+		return nil
+	}
+	if _, ok := ar.automobiles[mark]; ok {
+		return conflict("auto %q", mark)
+	}
+	delete(ar.automobiles, a.Mark)
+	a.Mark = mark
+	ar.automobiles[mark] = a
+	return nil
+}
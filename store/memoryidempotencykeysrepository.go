@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// MemoryIdempotencyKeysRepository is IdempotencyKeysRepository kept in process memory
+type MemoryIdempotencyKeysRepository struct {
+	mu   sync.Mutex
+	keys map[[2]string]*models.IdempotencyKey
+}
+
+// Constructor for MemoryIdempotencyKeysRepository
+func NewMemoryIdempotencyKeysRepository() *MemoryIdempotencyKeysRepository {
+	return &MemoryIdempotencyKeysRepository{
+		keys: make(map[[2]string]*models.IdempotencyKey),
+	}
+}
+
+// Reserve the key for a new request. Expired keys are dropped on the way.
+// If the key is taken, the stored one is returned together with ErrConflict
+func (ir *MemoryIdempotencyKeysRepository) Start(ctx context.Context, k *models.IdempotencyKey, now time.Time) (*models.IdempotencyKey, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	for id, stored := range ir.keys {
+		if !stored.ExpiresAt.After(now) {
+			delete(ir.keys, id)
+		}
+	}
+	id := [2]string{k.Scope, k.Key}
+	if stored, ok := ir.keys[id]; ok {
+		return copyIdempotencyKey(stored), conflict("idempotency key %q", k.Key)
+	}
+	k.CreatedAt = now
+	ir.keys[id] = copyIdempotencyKey(k)
+	return k, nil
+}
+
+// Save the response of the request that reserved the key, the key is kept until k.ExpiresAt
+func (ir *MemoryIdempotencyKeysRepository) Complete(ctx context.Context, k *models.IdempotencyKey) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	id := [2]string{k.Scope, k.Key}
+	if _, ok := ir.keys[id]; ok {
+		ir.keys[id] = copyIdempotencyKey(k)
+	}
+	return nil
+}
+
+// Release the key, e.g. after the request failed, so a retry runs again
+func (ir *MemoryIdempotencyKeysRepository) Delete(ctx context.Context, scope string, key string) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	delete(ir.keys, [2]string{scope, key})
+	return nil
+}
+
+func copyIdempotencyKey(k *models.IdempotencyKey) *models.IdempotencyKey {
+	c := *k
+	c.ResponseHeader = http.Header(k.ResponseHeader).Clone()
+	c.ResponseBody = append([]byte(nil), k.ResponseBody...)
+	return &c
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// MemoryLoginAttemptsRepository is LoginAttemptsRepository kept in process memory
+type MemoryLoginAttemptsRepository struct {
+	mu     sync.Mutex
+	lastID int64
+	// attempts in the order they were made
+	attempts []*models.LoginAttempt
+}
+
+// Constructor for MemoryLoginAttemptsRepository
+func NewMemoryLoginAttemptsRepository() *MemoryLoginAttemptsRepository {
+	return &MemoryLoginAttemptsRepository{}
+}
+
+// Save an attempt
+func (lr *MemoryLoginAttemptsRepository) Create(ctx context.Context, a *models.LoginAttempt) (*models.LoginAttempt, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.add(a)
+	return a, nil
+}
+
+func (lr *MemoryLoginAttemptsRepository) add(a *models.LoginAttempt) {
+	lr.lastID++
+	a.ID = lr.lastID
+	a.CreatedAt = time.Now()
+	stored := *a
+	lr.attempts = append(lr.attempts, &stored)
+}
+
+// Record a.Username starting to log in from a.IP, before its password is checked. If the username
+// has maxFailures failed or pending attempts from a.IP after since and after its last successful
+// login from a.IP, the attempt is recorded as LoginLocked, else as LoginPending until Finish.
+// last is the time of the latest failure. maxFailures 0 never locks
+func (lr *MemoryLoginAttemptsRepository) Start(ctx context.Context, a *models.LoginAttempt, maxFailures int, since time.Time) (time.Time, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	count := 0
+	var last time.Time
+	for i := len(lr.attempts) - 1; i >= 0; i-- {
+		stored := lr.attempts[i]
+		if !stored.CreatedAt.After(since) {
+			break
+		}
+		if stored.Username != a.Username || stored.IP != a.IP {
+			continue
+		}
+		if stored.Outcome == models.LoginSucceeded {
+			break
+		}
+		if stored.Failed() {
+			if count == 0 {
+				last = stored.CreatedAt
+			}
+			count++
+		}
+	}
+	a.Outcome = models.LoginPending
+	if maxFailures > 0 && count >= maxFailures {
+		a.Outcome = models.LoginLocked
+	}
+	lr.add(a)
+	return last, nil
+}
+
+// Set the outcome of an attempt recorded by Start
+func (lr *MemoryLoginAttemptsRepository) Finish(ctx context.Context, a *models.LoginAttempt) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	for i := len(lr.attempts) - 1; i >= 0; i-- {
+		if lr.attempts[i].ID == a.ID {
+			lr.attempts[i].Outcome = a.Outcome
+			break
+		}
+	}
+	return nil
+}
+
+// Attempts matching q, newest first
+func (lr *MemoryLoginAttemptsRepository) Select(ctx context.Context, q *LoginAttemptsQuery) ([]*models.LoginAttempt, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	attempts := make([]*models.LoginAttempt, 0)
+	skipped := 0
+	for i := len(lr.attempts) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(attempts) == q.Limit {
+			break
+		}
+		if !q.matches(lr.attempts[i]) {
+			continue
+		}
+		if skipped < q.Offset {
+			skipped++
+			continue
+		}
+		a := *lr.attempts[i]
+		attempts = append(attempts, &a)
+	}
+	return attempts, nil
+}
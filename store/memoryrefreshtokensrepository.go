@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// MemoryRefreshTokensRepository is RefreshTokensRepository kept in process memory
+type MemoryRefreshTokensRepository struct {
+	mu     sync.Mutex
+	lastID int
+	tokens map[string]*models.RefreshToken
+}
+
+// Constructor for MemoryRefreshTokensRepository
+func NewMemoryRefreshTokensRepository() *MemoryRefreshTokensRepository {
+	return &MemoryRefreshTokensRepository{
+		tokens: make(map[string]*models.RefreshToken),
+	}
+}
+
+// Save a freshly issued refresh token
+func (rr *MemoryRefreshTokensRepository) Create(ctx context.Context, t *models.RefreshToken) (*models.RefreshToken, error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if _, ok := rr.tokens[t.TokenHash]; ok {
+		return nil, conflict("refresh token")
+	}
+	rr.lastID++
+	t.ID = rr.lastID
+	t.CreatedAt = time.Now()
+	stored := *t
+	rr.tokens[t.TokenHash] = &stored
+	return t, nil
+}
+
+// Find token by hash, used or not
+func (rr *MemoryRefreshTokensRepository) FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	t, ok := rr.tokens[tokenHash]
+	if !ok {
+		return nil, notFound("refresh token")
+	}
+	found := *t
+	return &found, nil
+}
+
+// Mark token as used. ErrNotFound if the token is unknown, already used or expired
+func (rr *MemoryRefreshTokensRepository) Use(ctx context.Context, tokenHash string, now time.Time) (*models.RefreshToken, error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	t, ok := rr.tokens[tokenHash]
+	if !ok || t.UsedAt != nil || !t.ExpiresAt.After(now) {
+		return nil, notFound("refresh token")
+	}
+	usedAt := now
+	t.UsedAt = &usedAt
+	found := *t
+	return &found, nil
+}
+
+// Mark every unused token of the user as used
+func (rr *MemoryRefreshTokensRepository) RevokeByUsername(ctx context.Context, username string, now time.Time) error {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	for _, t := range rr.tokens {
+		if t.Username == username && t.UsedAt == nil {
+			usedAt := now
+			t.UsedAt = &usedAt
+		}
+	}
+	return nil
+}
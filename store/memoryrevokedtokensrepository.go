@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryRevokedTokensRepository is RevokedTokensRepository kept in process memory
+type MemoryRevokedTokensRepository struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+// Constructor for MemoryRevokedTokensRepository
+func NewMemoryRevokedTokensRepository() *MemoryRevokedTokensRepository {
+	return &MemoryRevokedTokensRepository{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Put access token id on the denylist until the token expires anyway
+func (rr *MemoryRevokedTokensRepository) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	now := time.Now()
+	for id, exp := range rr.revoked {
+		if exp.Before(now) {
+			delete(rr.revoked, id)
+		}
+	}
+	rr.revoked[jti] = expiresAt
+	return nil
+}
+
+// Check the denylist
+func (rr *MemoryRevokedTokensRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+	_, ok := rr.revoked[jti]
+	return ok, nil
+}
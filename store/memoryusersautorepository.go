@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// MemoryUsersautoRepository is UsersautoRepository kept in process memory.
+// Safe for concurrent use. Stored values are copied in and out, so callers never share them.
+type MemoryUsersautoRepository struct {
+	mu        sync.RWMutex
+	lastID    int
+	usersauto map[string]*models.Usersauto
+}
+
+// Constructor for MemoryUsersautoRepository
+func NewMemoryUsersautoRepository() *MemoryUsersautoRepository {
+	return &MemoryUsersautoRepository{
+		usersauto: make(map[string]*models.Usersauto),
+	}
+}
+
+// Create user in memory
+func (ur *MemoryUsersautoRepository) Create(ctx context.Context, u *models.Usersauto) (*models.Usersauto, error) {
+	if err := u.EncryptPassword(); err != nil {
+		return nil, err
+	}
+	if u.Role == "" {
+		u.Role = models.RoleViewer
+	}
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	if _, ok := ur.usersauto[u.Username]; ok {
+		return nil, conflict("user %q", u.Username)
+	}
+	ur.lastID++
+	u.ID = ur.lastID
+	stored := *u
+	ur.usersauto[u.Username] = &stored
+	return u, nil
+}
+
+// Hash and store a new password for the user
+func (ur *MemoryUsersautoRepository) UpdatePassword(ctx context.Context, u *models.Usersauto) error {
+	if err := u.EncryptPassword(); err != nil {
+		return err
+	}
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	if stored, ok := ur.usersauto[u.Username]; ok && stored.ID == u.ID {
+		stored.Password = u.Password
+	}
+	return nil
+}
+
+// Set role of the user. ErrNotFound if there is no such user
+func (ur *MemoryUsersautoRepository) UpdateRole(ctx context.Context, username string, role string) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	u, ok := ur.usersauto[username]
+	if !ok {
+		return notFound("user %q", username)
+	}
+	u.Role = role
+	return nil
+}
+
+// Find by Username
+func (ur *MemoryUsersautoRepository) FindByUsername(ctx context.Context, username string) (*models.Usersauto, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+	u, ok := ur.usersauto[username]
+	if !ok {
+		return nil, notFound("user %q", username)
+	}
+	found := *u
+	return &found, nil
+}
+
+// Select All, ordered by id
+func (ur *MemoryUsersautoRepository) SelectAll(ctx context.Context) ([]*models.Usersauto, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+	usersauto := make([]*models.Usersauto, 0, len(ur.usersauto))
+	for _, u := range ur.usersauto {
+		found := *u
+		usersauto = append(usersauto, &found)
+	}
+	sort.Slice(usersauto, func(i, j int) bool { return usersauto[i].ID < usersauto[j].ID })
+	return usersauto, nil
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Konatavi/go2HW2/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// SchemaVersion is the version of the newest embedded migration, the oldest schema this build works with
+var SchemaVersion = migrations.Latest()
+
+// Migrator applies the migrations embedded from migrations/ to the database of the config
+type Migrator struct {
+	m *migrate.Migrate
+}
+
+// NewMigrator opens its own connection, so closing the Migrator leaves an open Store untouched
+func NewMigrator(config *Config) (*Migrator, error) {
+	if config.Driver == DriverMemory {
+		return nil, errors.New("memory store has no schema to migrate")
+	}
+	db, err := sql.Open("postgres", config.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Migrator{m: m}, nil
+}
+
+// Up applies every pending migration
+func (mg *Migrator) Up() error {
+	return ignoreNoChange(mg.m.Up())
+}
+
+// Down rolls back steps migrations
+func (mg *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	return ignoreNoChange(mg.m.Steps(-steps))
+}
+
+// Force sets the version without running migrations, to recover from a dirty state
+func (mg *Migrator) Force(version int) error {
+	return mg.m.Force(version)
+}
+
+// Status returns the applied version; version is 0 when nothing was applied yet
+func (mg *Migrator) Status() (version uint, dirty bool, err error) {
+	version, dirty, err = mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// Close releases the connection of the migrator
+func (mg *Migrator) Close() error {
+	sourceErr, dbErr := mg.m.Close()
+	if sourceErr != nil {
+		return sourceErr
+	}
+	return dbErr
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
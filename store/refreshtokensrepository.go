@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// SQLRefreshTokensRepository is RefreshTokensRepository backed by postgres
+type SQLRefreshTokensRepository struct {
+	store *Store
+}
+
+var (
+	tableRefreshTokens   string = "refresh_tokens"
+	columnsRefreshTokens string = "id, token_hash, username, expires_at, used_at, created_at"
+)
+
+// Save a freshly issued refresh token
+func (rr *SQLRefreshTokensRepository) Create(ctx context.Context, t *models.RefreshToken) (*models.RefreshToken, error) {
+	ctx, cancel := rr.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("INSERT INTO %s (token_hash, username, expires_at) VALUES ($1, $2, $3) RETURNING id, created_at", tableRefreshTokens)
+	if err := rr.store.db.QueryRowContext(ctx, query, t.TokenHash, t.Username, t.ExpiresAt).Scan(&t.ID, &t.CreatedAt); err != nil {
+		return nil, sqlError(err, "refresh token")
+	}
+	return t, nil
+}
+
+// Find token by hash, used or not
+func (rr *SQLRefreshTokensRepository) FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	ctx, cancel := rr.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE token_hash=$1", columnsRefreshTokens, tableRefreshTokens)
+	t := models.RefreshToken{}
+	err := rr.store.db.QueryRowContext(ctx, query, tokenHash).Scan(&t.ID, &t.TokenHash, &t.Username, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, sqlError(err, "refresh token")
+	}
+	return &t, nil
+}
+
+// Mark token as used in one statement, so two concurrent refreshes can not both win.
+// ErrNotFound if the token is unknown, already used or expired
+func (rr *SQLRefreshTokensRepository) Use(ctx context.Context, tokenHash string, now time.Time) (*models.RefreshToken, error) {
+	ctx, cancel := rr.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("UPDATE %s SET used_at = $2 WHERE token_hash=$1 AND used_at IS NULL AND expires_at > $2 RETURNING %s", tableRefreshTokens, columnsRefreshTokens)
+	t := models.RefreshToken{}
+	err := rr.store.db.QueryRowContext(ctx, query, tokenHash, now).Scan(&t.ID, &t.TokenHash, &t.Username, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, sqlError(err, "refresh token")
+	}
+	return &t, nil
+}
+
+// Mark every unused token of the user as used
+func (rr *SQLRefreshTokensRepository) RevokeByUsername(ctx context.Context, username string, now time.Time) error {
+	ctx, cancel := rr.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("UPDATE %s SET used_at = $2 WHERE username=$1 AND used_at IS NULL", tableRefreshTokens)
+	_, err := rr.store.db.ExecContext(ctx, query, username, now)
+	return sqlError(err, "refresh tokens")
+}
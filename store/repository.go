@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Konatavi/go2HW2/internal/app/models"
+)
+
+// Repositories report failures as errors of kind ErrNotFound, ErrConflict, ErrVersionMismatch or ErrUnavailable,
+// see Error. Lookups by key return ErrNotFound if there is no such row.
+// Writes with ifVersion other than 0 change the row only at that version, else ErrVersionMismatch.
+
+// AutomobilesRepository is implemented by every store driver for table automobiles
+type AutomobilesRepository interface {
+	Create(ctx context.Context, a *models.Automobiles) (*models.Automobiles, error)
+	DeleteByMark(ctx context.Context, mark string, ifVersion int) error
+	FindAutomobileByMark(ctx context.Context, mark string) (*models.Automobiles, error)
+	PatchByMark(ctx context.Context, mark string, patch *AutomobilePatch, ifVersion int) (*models.Automobiles, error)
+	SelectAll(ctx context.Context) ([]*models.Automobiles, error)
+	SelectPage(ctx context.Context, q *AutomobilesQuery) (*AutomobilesPage, error)
+	UpdateByMark(ctx context.Context, mark string, newAuto *models.Automobiles, ifVersion int) (*models.Automobiles, error)
+}
+
+// UsersautoRepository is implemented by every store driver for table usersauto
+type UsersautoRepository interface {
+	Create(ctx context.Context, u *models.Usersauto) (*models.Usersauto, error)
+	FindByUsername(ctx context.Context, username string) (*models.Usersauto, error)
+	UpdatePassword(ctx context.Context, u *models.Usersauto) error
+	UpdateRole(ctx context.Context, username string, role string) error
+	SelectAll(ctx context.Context) ([]*models.Usersauto, error)
+}
+
+// RefreshTokensRepository keeps single-use refresh tokens
+type RefreshTokensRepository interface {
+	Create(ctx context.Context, t *models.RefreshToken) (*models.RefreshToken, error)
+	FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	Use(ctx context.Context, tokenHash string, now time.Time) (*models.RefreshToken, error)
+	RevokeByUsername(ctx context.Context, username string, now time.Time) error
+}
+
+// RevokedTokensRepository is the denylist of access tokens revoked before they expire
+type RevokedTokensRepository interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// IdempotencyKeysRepository keeps the first response to requests with an Idempotency-Key
+type IdempotencyKeysRepository interface {
+	Start(ctx context.Context, k *models.IdempotencyKey, now time.Time) (*models.IdempotencyKey, error)
+	Complete(ctx context.Context, k *models.IdempotencyKey) error
+	Delete(ctx context.Context, scope string, key string) error
+}
+
+// LoginAttemptsRepository audits logins and locks out a username for a client IP after repeated failures
+type LoginAttemptsRepository interface {
+	Create(ctx context.Context, a *models.LoginAttempt) (*models.LoginAttempt, error)
+	Start(ctx context.Context, a *models.LoginAttempt, maxFailures int, since time.Time) (last time.Time, err error)
+	Finish(ctx context.Context, a *models.LoginAttempt) error
+	Select(ctx context.Context, q *LoginAttemptsQuery) ([]*models.LoginAttempt, error)
+}
+
+var (
+	_ AutomobilesRepository = (*SQLAutomobilesRepository)(nil)
+	_ AutomobilesRepository = (*MemoryAutomobilesRepository)(nil)
+	_ UsersautoRepository   = (*SQLUsersautoRepository)(nil)
+	_ UsersautoRepository   = (*MemoryUsersautoRepository)(nil)
+
+	_ RefreshTokensRepository = (*SQLRefreshTokensRepository)(nil)
+	_ RefreshTokensRepository = (*MemoryRefreshTokensRepository)(nil)
+	_ RevokedTokensRepository = (*SQLRevokedTokensRepository)(nil)
+	_ RevokedTokensRepository = (*MemoryRevokedTokensRepository)(nil)
+
+	_ IdempotencyKeysRepository = (*SQLIdempotencyKeysRepository)(nil)
+	_ IdempotencyKeysRepository = (*MemoryIdempotencyKeysRepository)(nil)
+	_ LoginAttemptsRepository   = (*SQLLoginAttemptsRepository)(nil)
+	_ LoginAttemptsRepository   = (*MemoryLoginAttemptsRepository)(nil)
+
+	_ AutomobilesRepository     = (*observedAutomobiles)(nil)
+	_ UsersautoRepository       = (*observedUsersauto)(nil)
+	_ RefreshTokensRepository   = (*observedRefreshTokens)(nil)
+	_ RevokedTokensRepository   = (*observedRevokedTokens)(nil)
+	_ IdempotencyKeysRepository = (*observedIdempotencyKeys)(nil)
+	_ LoginAttemptsRepository   = (*observedLoginAttempts)(nil)
+)
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SQLRevokedTokensRepository is RevokedTokensRepository backed by postgres
+type SQLRevokedTokensRepository struct {
+	store *Store
+}
+
+var (
+	tableRevokedTokens string = "revoked_tokens"
+)
+
+// Put access token id on the denylist until the token expires anyway.
+// Entries of tokens that already expired are dropped on the way
+func (rr *SQLRevokedTokensRepository) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ctx, cancel := rr.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("INSERT INTO %s (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING", tableRevokedTokens)
+	if _, err := rr.store.db.ExecContext(ctx, query, jti, expiresAt); err != nil {
+		return sqlError(err, "revoked token")
+	}
+	query = fmt.Sprintf("DELETE FROM %s WHERE expires_at < now()", tableRevokedTokens)
+	_, err := rr.store.db.ExecContext(ctx, query)
+	return sqlError(err, "revoked tokens")
+}
+
+// Check the denylist
+func (rr *SQLRevokedTokensRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := rr.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE jti=$1)", tableRevokedTokens)
+	var revoked bool
+	err := rr.store.db.QueryRowContext(ctx, query, jti).Scan(&revoked)
+	return revoked, sqlError(err, "revoked token")
+}
@@ -1,18 +1,32 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
+// Supported store drivers
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
 //Instance of store
 type Store struct {
 	config                *Config
-	db                    *sql.DB
-	usersautoRepository   *UsersautoRepository
-	automobilesRepository *AutomobilesRepository
+	db                    *tracedDB
+	usersautoRepository   UsersautoRepository
+	automobilesRepository AutomobilesRepository
+	refreshTokens         RefreshTokensRepository
+	revokedTokens         RevokedTokensRepository
+	idempotencyKeys       IdempotencyKeysRepository
+	loginAttempts         LoginAttemptsRepository
+	hooks                 []QueryHook
 }
 
 // Constructor for store
@@ -24,43 +38,183 @@ func New(config *Config) *Store {
 
 //Open store method
 func (s *Store) Open() error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	s.observeRepositories()
+	return nil
+}
+
+func (s *Store) open() error {
+	switch s.config.Driver {
+	case "", DriverPostgres:
+		return s.openPostgres()
+	case DriverMemory:
+		s.usersautoRepository = NewMemoryUsersautoRepository()
+		s.automobilesRepository = NewMemoryAutomobilesRepository()
+		s.refreshTokens = NewMemoryRefreshTokensRepository()
+		s.revokedTokens = NewMemoryRevokedTokensRepository()
+		s.idempotencyKeys = NewMemoryIdempotencyKeysRepository()
+		s.loginAttempts = NewMemoryLoginAttemptsRepository()
+		log.Println("Using in-memory store")
+		return nil
+	default:
+		return fmt.Errorf("unknown store driver %q", s.config.Driver)
+	}
+}
+
+func (s *Store) openPostgres() error {
 	db, err := sql.Open("postgres", s.config.DatabaseURL)
 	if err != nil {
 		return err
 	}
+	s.db = &tracedDB{DB: db}
+	s.SetPool(s.config)
 	//Проверим, что все ок. Реально соединение тут не создается. Соединение только при первом вызове
 	//db.Ping() // Пустой SELECT *
-	if err := db.Ping(); err != nil {
+	if err := s.connect(); err != nil {
+		db.Close()
+		s.db = nil
 		return err
 	}
-	s.db = db
+	s.usersautoRepository = &SQLUsersautoRepository{
+		store: s,
+	}
+	s.automobilesRepository = &SQLAutomobilesRepository{
+		store: s,
+	}
+	s.refreshTokens = &SQLRefreshTokensRepository{
+		store: s,
+	}
+	s.revokedTokens = &SQLRevokedTokensRepository{
+		store: s,
+	}
+	s.idempotencyKeys = &SQLIdempotencyKeysRepository{
+		store: s,
+	}
+	s.loginAttempts = &SQLLoginAttemptsRepository{
+		store: s,
+	}
 	log.Println("Connection to db successfully")
 	return nil
 }
 
+// Backoff between connection attempts on start
+const (
+	connectBackoffMin = 100 * time.Millisecond
+	connectBackoffMax = 5 * time.Second
+)
+
+// connect pings the database until it answers or ConnectTimeout runs out,
+// so the server can start before Postgres is up. ConnectTimeout 0 pings once.
+func (s *Store) connect() error {
+	if s.config.ConnectTimeout == 0 {
+		return s.db.Ping()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ConnectTimeout)
+	defer cancel()
+	backoff := connectBackoffMin
+	for attempt := 1; ; attempt++ {
+		err := s.db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("can not connect to db in %s after %d attempts: %w", s.config.ConnectTimeout, attempt, err)
+		}
+		log.Printf("Connection to db failed (attempt %d), retrying in %s: %s", attempt, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("can not connect to db in %s after %d attempts: %w", s.config.ConnectTimeout, attempt, err)
+		}
+		if backoff *= 2; backoff > connectBackoffMax {
+			backoff = connectBackoffMax
+		}
+	}
+}
+
+// SetPool applies the pool settings of config, it is safe to call on a running store
+func (s *Store) SetPool(config *Config) {
+	if s.db == nil {
+		return
+	}
+	s.db.SetMaxOpenConns(config.MaxOpenConns)
+	s.db.SetMaxIdleConns(config.MaxIdleConns)
+	s.db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	s.db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+}
+
+// withTimeout bounds a repository call with QueryTimeout
+func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.config.QueryTimeout)
+}
+
+// Stats of the connection pool, zero for the memory driver
+func (s *Store) Stats() sql.DBStats {
+	if s.db == nil {
+		return sql.DBStats{}
+	}
+	return s.db.Stats()
+}
+
 //Close store method
 func (s *Store) Close() {
-	s.db.Close()
+	if s.db != nil {
+		s.db.Close()
+	}
 }
 
-//Public for UsersautoRepositoryRepo
-func (s *Store) Usersauto() *UsersautoRepository {
-	if s.usersautoRepository != nil {
-		return s.usersautoRepository
+// Ping checks that the database is reachable
+func (s *Store) Ping(ctx context.Context) error {
+	if s.db == nil {
+		return nil
 	}
-	s.usersautoRepository = &UsersautoRepository{
-		store: s,
-	}
-	return s.usersautoRepository
+	return s.db.PingContext(ctx)
 }
 
-//Public for ArticleRepo
-func (s *Store) Automobiles() *AutomobilesRepository {
-	if s.automobilesRepository != nil {
-		return s.automobilesRepository
+// MigrationVersion reads the schema version golang-migrate recorded in schema_migrations.
+// The memory driver has no schema and always reports SchemaVersion.
+func (s *Store) MigrationVersion(ctx context.Context) (version uint, dirty bool, err error) {
+	if s.db == nil {
+		return SchemaVersion, false, nil
 	}
-	s.automobilesRepository = &AutomobilesRepository{
-		store: s,
+	err = s.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
 	}
+	return version, dirty, err
+}
+
+//Public for UsersautoRepositoryRepo
+func (s *Store) Usersauto() UsersautoRepository {
+	return s.usersautoRepository
+}
+
+//Public for AutomobilesRepository
+func (s *Store) Automobiles() AutomobilesRepository {
 	return s.automobilesRepository
 }
+
+// RefreshTokens repository
+func (s *Store) RefreshTokens() RefreshTokensRepository {
+	return s.refreshTokens
+}
+
+// RevokedTokens repository, the access token denylist
+func (s *Store) RevokedTokens() RevokedTokensRepository {
+	return s.revokedTokens
+}
+
+// IdempotencyKeys repository
+func (s *Store) IdempotencyKeys() IdempotencyKeysRepository {
+	return s.idempotencyKeys
+}
+
+// LoginAttempts repository, the login audit
+func (s *Store) LoginAttempts() LoginAttemptsRepository {
+	return s.loginAttempts
+}
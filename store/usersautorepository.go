@@ -1,69 +1,109 @@
 package store
 
 import (
+	"context"
 	"fmt"
 	"log"
 
 	"github.com/Konatavi/go2HW2/internal/app/models"
 )
 
-type UsersautoRepository struct {
+// SQLUsersautoRepository is UsersautoRepository backed by postgres
+type SQLUsersautoRepository struct {
 	store *Store
 }
 
 var (
-	tableUser string = "usersauto"
+	tableUser   string = "usersauto"
+	columnsUser string = "id, username, password, role"
 )
 
 //Create user in database
-func (ur *UsersautoRepository) Create(u *models.Usersauto) (*models.Usersauto, error) {
-	query := fmt.Sprintf("INSERT INTO %s (username, password) VALUES ($1, $2) RETURNING id", tableUser)
-	if err := ur.store.db.QueryRow(
+func (ur *SQLUsersautoRepository) Create(ctx context.Context, u *models.Usersauto) (*models.Usersauto, error) {
+	if err := u.EncryptPassword(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ur.store.withTimeout(ctx)
+	defer cancel()
+	if u.Role == "" {
+		u.Role = models.RoleViewer
+	}
+	query := fmt.Sprintf("INSERT INTO %s (username, password, role) VALUES ($1, $2, $3) RETURNING id", tableUser)
+	if err := ur.store.db.QueryRowContext(ctx,
 		query,
 		u.Username,
 		u.Password,
+		u.Role,
 	).Scan(&u.ID); err != nil {
-		return nil, err
+		return nil, sqlError(err, "user %q", u.Username)
 	}
 	return u, nil
 }
 
-//Find by Username
-func (ur *UsersautoRepository) FindByUsername(username string) (*models.Usersauto, bool, error) {
-	usersauto, err := ur.SelectAll()
-	var founded bool
+//Hash and store a new password for the user, e.g. rehash of a legacy plaintext one
+func (ur *SQLUsersautoRepository) UpdatePassword(ctx context.Context, u *models.Usersauto) error {
+	if err := u.EncryptPassword(); err != nil {
+		return err
+	}
+	ctx, cancel := ur.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("UPDATE %s SET password = $1 WHERE id = $2", tableUser)
+	_, err := ur.store.db.ExecContext(ctx, query, u.Password, u.ID)
+	return sqlError(err, "user %q", u.Username)
+}
+
+//Set role of the user. ErrNotFound if there is no such user
+func (ur *SQLUsersautoRepository) UpdateRole(ctx context.Context, username string, role string) error {
+	ctx, cancel := ur.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("UPDATE %s SET role = $1 WHERE username = $2", tableUser)
+	res, err := ur.store.db.ExecContext(ctx, query, role, username)
 	if err != nil {
-		return nil, founded, err
+		return sqlError(err, "user %q", username)
 	}
-	var usersautoFinded *models.Usersauto
-	for _, u := range usersauto {
-		if u.Username == username {
-			usersautoFinded = u
-			founded = true
-			break
-		}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return sqlError(err, "user %q", username)
+	}
+	if affected == 0 {
+		return notFound("user %q", username)
 	}
-	return usersautoFinded, founded, nil
+	return nil
+}
+
+//Find by Username. Uses the unique index on username
+func (ur *SQLUsersautoRepository) FindByUsername(ctx context.Context, username string) (*models.Usersauto, error) {
+	ctx, cancel := ur.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE username=$1", columnsUser, tableUser)
+	u := models.Usersauto{}
+	err := ur.store.db.QueryRowContext(ctx, query, username).Scan(&u.ID, &u.Username, &u.Password, &u.Role)
+	if err != nil {
+		return nil, sqlError(err, "user %q", username)
+	}
+	return &u, nil
 }
 
 //Select All
-func (ur *UsersautoRepository) SelectAll() ([]*models.Usersauto, error) {
-	query := fmt.Sprintf("SELECT * FROM %s", tableUser)
-	rows, err := ur.store.db.Query(query)
+func (ur *SQLUsersautoRepository) SelectAll(ctx context.Context) ([]*models.Usersauto, error) {
+	ctx, cancel := ur.store.withTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("SELECT %s FROM %s", columnsUser, tableUser)
+	rows, err := ur.store.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, sqlError(err, "users")
 	}
 	defer rows.Close()
 	usersauto := make([]*models.Usersauto, 0)
 	for rows.Next() {
 		u := models.Usersauto{}
-		err := rows.Scan(&u.ID, &u.Username, &u.Password)
+		err := rows.Scan(&u.ID, &u.Username, &u.Password, &u.Role)
 		if err != nil {
 			log.Println(err)
 			continue
 		}
 		usersauto = append(usersauto, &u)
 	}
-	return usersauto, nil
+	return usersauto, sqlError(rows.Err(), "users")
 
 }